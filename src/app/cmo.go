@@ -3,15 +3,35 @@ package main
 import (
 	"app/controllers"
 	"app/models"
+	"flag"
 	"github.com/dchest/captcha"
 	"log"
 	"net/http"
 	"os"
 	"runtime"
+	"time"
+)
+
+var (
+	migrate = flag.String("migrate", "", "run the named data migration and exit")
+	proxies = flag.Int("proxies", 1, "number of trusted proxies setting X-Forwarded-For")
 )
 
 func main() {
+	flag.Parse()
+	if *migrate != "" {
+		m, ok := models.Migrations[*migrate]
+		if !ok {
+			log.Fatal("unknown migration: ", *migrate)
+		}
+		if err := m(); err != nil {
+			log.Fatal("migration ", *migrate, ": ", err)
+		}
+		log.Print("migration done: ", *migrate)
+		return
+	}
 	runtime.GOMAXPROCS(runtime.NumCPU())
+	controllers.TrustedProxies = *proxies
 	router := models.Router
 	// static
 	router.Add("GET", "/static/", http.FileServer(http.Dir(models.BASE_DIR))).Name("static")
@@ -53,28 +73,46 @@ func main() {
 
 	router.Add("GET", "/photos/{id:[0-9a-z]+}/{photo:[0-9a-z]*}", controllers.Handler(controllers.Photos)).Name("photos")
 	router.Add("GET", "/photo/{id:[0-9a-z]+}/{kind:p|c}/{photo:[0-9a-z]*}", controllers.Handler(controllers.ExternalPhoto)).Name("external_photo")
+	router.Add("GET", "/view/{photo:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.View)).Name("view")
 	router.Add("GET", "/fake/{photo:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.Fake)).Name("fake")
 	router.Add("GET", "/abuse/{photo:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.Abuse)).Name("abuse")
 	router.Add("GET", "/avatar/{photo:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.SetAvatar)).Name("avatar")
 	router.Add("GET", "/top/{page:[0-9]+}", controllers.Handler(controllers.TopVoted)).Name("top")
+	router.Add("GET", "/trending/{page:[0-9]+}", controllers.Handler(controllers.Trending)).Name("trending")
 	router.Add("GET", "/latest/{page:[0-9]+}", controllers.Handler(controllers.Latest)).Name("latest")
 	router.Add("GET", "/random/{page:[0-9]+}", controllers.Handler(controllers.Random)).Name("random")
 	router.Add("GET", "/empty", controllers.Handler(controllers.Empty)).Name("empty")
 
 	// admin
+	router.Add("POST", "/lov3lymin1/limits", controllers.Handler(controllers.ContestLimits)).Name("contest_limits")
 	router.Add("GET", "/lov3lymin1", controllers.Handler(controllers.Admin)).Name("admin")
 	router.Add("GET", "/lov3lymin2/delphoto/{id:[0-9a-z]+}", controllers.Handler(controllers.DelPhoto)).Name("del_photo")
 	router.Add("GET", "/lov3lymin3/deluser/{id:[0-9a-z]+}", controllers.Handler(controllers.DelUser)).Name("del_user")
+	router.Add("GET", "/lov3lymin4/voidvotes/{id:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.VoidVotes)).Name("void_votes")
+	router.Add("GET", "/lov3lymin5/vetvoter/{id:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.VetVoter)).Name("vet_voter")
 
 	// comments
+	router.Add("POST", "/comment/{kind:p|c}/{id:[0-9a-z]+}/edit/{comment:[0-9a-z]+}", controllers.Handler(controllers.EditComment)).Name("edit_comment")
+	router.Add("GET", "/comment/{kind:p|c}/{id:[0-9a-z]+}/delete/{comment:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.DeleteComment)).Name("delete_comment")
+	router.Add("GET", "/comment/{kind:p|c}/{id:[0-9a-z]+}/report/{comment:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.ReportComment)).Name("report_comment")
 	router.Add("GET", "/comment/{kind:p|c}/{id:[0-9a-z]+}", controllers.Handler(controllers.CommentForm)).Name("comments")
 	router.Add("POST", "/comment/{kind:p|c}/{id:[0-9a-z]+}", controllers.Handler(controllers.Comment))
 
 	// votes
 	router.Add("GET", "/vote/{photo:[0-9a-z]+}/{csrf_token:[0-9a-z]+}/{contest:[0-9a-z]*}", controllers.Handler(controllers.Vote)).Name("vote")
 	router.Add("GET", "/getvote/{photo:[0-9a-z]+}/{contest:[0-9a-z]*}", controllers.Handler(controllers.GetVote)).Name("get_vote")
+	router.Add("GET", "/unvote/{id:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.Unvote)).Name("unvote")
+	router.Add("GET", "/ratings/export", controllers.Handler(controllers.ExportRatings)).Name("export_ratings")
+	router.Add("GET", "/ratings", controllers.Handler(controllers.Ratings)).Name("ratings")
 	router.Add("POST", "/filter/", controllers.Handler(controllers.Filter)).Name("filter")
+	router.Add("GET", "/filters/use", controllers.Handler(controllers.UseFilter)).Name("use_filter")
+	router.Add("GET", "/filters/del/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.DelFilter)).Name("del_filter")
 	router.Add("GET", "/getphotovotes/{id:[0-9a-z]+}", controllers.Handler(controllers.GetPhotoVotes)).Name("get_photo_votes")
+	router.Add("GET", "/breakdown/{id:[0-9a-z]+}", controllers.Handler(controllers.PhotoBreakdown)).Name("photo_breakdown")
+	router.Add("GET", "/analytics/{id:[0-9a-z]+}", controllers.Handler(controllers.PhotoAnalytics)).Name("photo_analytics")
+
+	// push events
+	router.Add("GET", "/events", http.HandlerFunc(controllers.Events)).Name("events")
 
 	// contests
 	router.Add("GET", "/contests/{id:[0-9a-z]*}", controllers.Handler(controllers.ContestForm)).Name("contest")
@@ -86,19 +124,37 @@ func main() {
 	router.Add("POST", "/registercontest/{id:[0-9a-z]+}", controllers.Handler(controllers.RegisterContest))
 
 	router.Add("GET", "/pendingaprovals/{id:[0-9a-z]+}", controllers.Handler(controllers.PendingApprovals)).Name("pending_approvals")
+	router.Add("GET", "/members/{id:[0-9a-z]+}/{role:organizer|juror|invited}/del/{user:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.DelMember)).Name("del_member")
+	router.Add("POST", "/members/{id:[0-9a-z]+}/{role:organizer|juror|invited}", controllers.Handler(controllers.AddMember)).Name("add_member")
+	router.Add("GET", "/joincontest/{id:[0-9a-z]+}/{code:[0-9a-z]+}", controllers.Handler(controllers.JoinContest)).Name("join_contest")
+	router.Add("POST", "/recurring/{id:[0-9a-z]+}", controllers.Handler(controllers.MakeRecurring)).Name("make_recurring")
+	router.Add("GET", "/series/{id:[0-9a-z]+}/stop/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.StopSeries)).Name("stop_series")
+	router.Add("POST", "/series/{id:[0-9a-z]+}/template", controllers.Handler(controllers.SeriesTemplate)).Name("series_template")
+	router.Add("GET", "/series/{id:[0-9a-z]+}", controllers.Handler(controllers.SeriesPage)).Name("series")
+	router.Add("GET", "/jury/{id:[0-9a-z]+}", controllers.Handler(controllers.Jury)).Name("jury")
+	router.Add("POST", "/jury/{id:[0-9a-z]+}/{photo:[0-9a-z]+}", controllers.Handler(controllers.ScoreEntry)).Name("score_entry")
+	router.Add("GET", "/withdrawcontest/{id:[0-9a-z]+}/{photo:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.WithdrawContest)).Name("withdraw_contest")
 	router.Add("GET", "/conteststatus/{id:[0-9a-z]+}", controllers.Handler(controllers.ContestStatus)).Name("contest_status")
-	router.Add("GET", "/approvecontest/{id:[0-9a-z]+}/{user:[0-9a-z]+}/{csrf_token:[0-9a-z]+}/{res:y|n}", controllers.Handler(controllers.ApproveContest)).Name("approve_contest")
+	router.Add("GET", "/results/{id:[0-9a-z]+}", controllers.Handler(controllers.ContestResults)).Name("contest_results")
+	router.Add("POST", "/approvecontest/{id:[0-9a-z]+}", controllers.Handler(controllers.ApproveContest)).Name("approve_contest")
 	router.Add("GET", "/viewcontest/{id:[0-9a-z]+}/{photo:[0-9a-z]*}", controllers.Handler(controllers.ViewContest)).Name("view_contest")
 	router.Add("GET", "/contestlist/{list:adm|vot|fin|pop}", controllers.Handler(controllers.ContestList)).Name("contest_list")
 
 	// rankings
+	router.Add("GET", "/rankings/{by:[a-z]+}", controllers.Handler(controllers.RankingsBy)).Name("rankings_by")
 	router.Add("GET", "/rankings", controllers.Handler(controllers.Rankings)).Name("rankings")
+	router.Add("GET", "/duels", controllers.Handler(controllers.DuelRankings)).Name("duel_rankings")
+	router.Add("GET", "/duel/{contest:[0-9a-z]*}", controllers.Handler(controllers.Duel)).Name("duel")
+	router.Add("POST", "/duel/{contest:[0-9a-z]*}", controllers.Handler(controllers.Prefer)).Name("prefer")
 
 	// messageds
 	router.Add("GET", "/sendmessage/{to:[0-9a-z]+}", controllers.Handler(controllers.SendMessageForm)).Name("send_message")
 	router.Add("POST", "/sendmessage/{to:[0-9a-z]+}", controllers.Handler(controllers.SendMessage))
 	router.Add("GET", "/messages", controllers.Handler(controllers.Messages)).Name("messages")
 	router.Add("GET", "/delmessage/{id:[0-9a-z]+}", controllers.Handler(controllers.DelMessage)).Name("delete_message")
+	router.Add("GET", "/block/{user:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.Block)).Name("block")
+	router.Add("GET", "/unblock/{user:[0-9a-z]+}/{csrf_token:[0-9a-z]+}", controllers.Handler(controllers.Unblock)).Name("unblock")
+	router.Add("POST", "/privacy/", controllers.Handler(controllers.Privacy)).Name("privacy")
 
 	//google web masters
 	router.Add("GET", "/google4b899b9e0462f0cd.html", http.HandlerFunc(controllers.GoogleSiteVerification)).Name("google1")
@@ -113,10 +169,16 @@ func main() {
 
 	// language
 	router.Add("GET", "/language/{lang:[a-z]{2}}", controllers.Handler(controllers.SetLanguage)).Name("language")
+	router.Add("POST", "/timezone", controllers.Handler(controllers.SetTimezone)).Name("timezone")
 
 	// index
 	router.Add("GET", "/", controllers.Handler(controllers.Index)).Name("index")
 
+	go models.RunContests(30 * time.Second)
+	go models.WatchVotes(time.Hour)
+	go models.FlushViews(30 * time.Second)
+	go models.WatchRandom(24 * time.Hour)
+
 	log.Print("The server is listening...")
 	port := os.Getenv("PORT")
 	if port == "" {
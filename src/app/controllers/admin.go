@@ -4,6 +4,7 @@ import (
 	"app/models"
 	"labix.org/v2/mgo/bson"
 	"net/http"
+	"strconv"
 )
 
 func Admin(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
@@ -29,15 +30,55 @@ func Admin(w http.ResponseWriter, req *http.Request, ctx *models.Context) error
 		return err
 	}
 
+	voters, err := models.FlaggedVoters(ctx)
+	if err != nil {
+		models.Log("error getting flagged voters: ", err.Error())
+	}
+	voteCounts := make(map[bson.ObjectId]int, len(voters))
+	for _, v := range voters {
+		voteCounts[v.Id], _ = ctx.C(V).Find(bson.M{"user": v.Id}).Count()
+	}
+	engagement, err := models.LowEngagement(ctx, 50)
+	if err != nil {
+		models.Log("error getting low engagement photos: ", err.Error())
+	}
+
 	return T("admin.html").Execute(w, map[string]interface{}{
-		"ctx":    ctx,
-		"pp":     pp,
-		"photos": photos,
-		"up":     up,
-		"users":  users,
+		"ctx":        ctx,
+		"pp":         pp,
+		"photos":     photos,
+		"up":         up,
+		"users":      users,
+		"comments":   reportedComments(ctx),
+		"voters":     voters,
+		"voteCounts": voteCounts,
+		"engagement": engagement,
+		"limits":     models.GetContestLimits(ctx),
 	})
 }
 
+// ContestLimits saves the maximum windows of the contest deadlines.
+func ContestLimits(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil || !ctx.User.Admin {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	admission, aerr := strconv.Atoi(req.FormValue("max_admission_days"))
+	voting, verr := strconv.Atoi(req.FormValue("max_voting_days"))
+	if aerr != nil || verr != nil || admission < 1 || voting <= admission {
+		ctx.Session.AddFlash(models.F(models.ERROR, trans("The voting window must be longer than the admission one.", ctx)))
+	} else if err := models.SaveContestLimits(ctx, &models.ContestLimits{MaxAdmissionDays: admission, MaxVotingDays: voting}); err != nil {
+		models.Log("error saving contest limits: ", err.Error())
+		ctx.Session.AddFlash(models.F(models.ERROR, trans("Problem saving the limits:", ctx), err.Error()))
+	} else {
+		ctx.Session.AddFlash(models.F(models.SUCCESS, trans("Contest limits saved.", ctx)))
+	}
+	http.Redirect(w, req, reverse("admin"), http.StatusSeeOther)
+	return nil
+}
+
 func DelUser(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 	if ctx.User == nil || !ctx.User.Admin {
 		return perform_status(w, req, http.StatusForbidden)
@@ -64,3 +105,39 @@ func DelPhoto(w http.ResponseWriter, req *http.Request, ctx *models.Context) err
 	http.Redirect(w, req, reverse("admin"), http.StatusSeeOther)
 	return nil
 }
+
+func VoidVotes(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	return voterAction(w, req, ctx, models.VoidVotes, trans("Votes voided!", ctx))
+}
+
+func VetVoter(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	return voterAction(w, req, ctx, models.VetVoter, trans("Voter trusted!", ctx))
+}
+
+func voterAction(w http.ResponseWriter, req *http.Request, ctx *models.Context, action func(*models.Context, bson.ObjectId) error, msg string) error {
+	if ctx.User == nil || !ctx.User.Admin {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if err := action(ctx, bson.ObjectIdHex(id)); err != nil {
+		models.Log("error updating voter: ", err.Error())
+		ctx.Session.AddFlash(models.F(models.ERROR, trans("Problem updating voter:", ctx), err.Error()))
+	} else {
+		ctx.Session.AddFlash(models.F(models.SUCCESS, msg))
+	}
+	http.Redirect(w, req, reverse("admin"), http.StatusSeeOther)
+	return nil
+}
+
+func reportedComments(ctx *models.Context) (comments []*models.Comment) {
+	if err := ctx.C(CM).Find(bson.M{"reporters.0": bson.M{"$exists": true}}).Sort("-_id").All(&comments); err != nil {
+		models.Log("error getting reported comments: ", err.Error())
+	}
+	return
+}
@@ -210,6 +210,8 @@ func Profile(w http.ResponseWriter, req *http.Request, ctx *models.Context) erro
 		ctx.Session.AddFlash(models.F(models.ERROR, trans("Problem editing profile:", ctx), err.Error()))
 		models.Log(err.Error())
 		r.Err = err
+	} else {
+		go syncAuthor(ctx.User.Id)
 	}
 	ctx.Session.AddFlash(models.F(models.SUCCESS, trans("Profile updated succesfully!", ctx)))
 	return ProfileForm(w, req, ctx)
@@ -439,3 +441,10 @@ func typeAhead(field, q string, ctx *models.Context) string {
 	result = strings.TrimRight(result, ",")
 	return `{"options":[` + result + `]}`
 }
+
+// syncAuthor updates the copies of the user data in the background.
+func syncAuthor(id bson.ObjectId) {
+	if err := models.SyncAuthor(id); err != nil {
+		models.Log("error syncing author data: ", err.Error())
+	}
+}
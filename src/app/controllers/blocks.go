@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"app/models"
+	"fmt"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+)
+
+func Block(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	return block(w, req, ctx, "$addToSet")
+}
+
+func Unblock(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	return block(w, req, ctx, "$pull")
+}
+
+func block(w http.ResponseWriter, req *http.Request, ctx *models.Context, op string) error {
+	if ctx.User == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	userId := req.URL.Query().Get(":user")
+	if !bson.IsObjectIdHex(userId) || userId == ctx.User.Id.Hex() {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if err := ctx.C(U).UpdateId(ctx.User.Id, bson.M{op: bson.M{"blocked": bson.ObjectIdHex(userId)}}); err != nil {
+		models.Log("error updating block list: ", err.Error())
+		return err
+	}
+	fmt.Fprint(w, "ok")
+	return nil
+}
+
+func Privacy(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	privacy := req.FormValue("privacy")
+	if privacy != models.MSG_EVERYONE && privacy != models.MSG_VOTED && privacy != models.MSG_NOBODY {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if err := ctx.C(U).UpdateId(ctx.User.Id, bson.M{"$set": bson.M{"messageprivacy": privacy}}); err != nil {
+		models.Log("error updating privacy: ", err.Error())
+		ctx.Session.AddFlash(models.F(models.ERROR, trans("Problem updating privacy settings:", ctx), err.Error()))
+	} else {
+		ctx.Session.AddFlash(models.F(models.SUCCESS, trans("Privacy settings updated!", ctx)))
+	}
+	http.Redirect(w, req, reverse("messages"), http.StatusSeeOther)
+	return nil
+}
+
+// canMessage is used by the templates to hide the message button
+// for users that would not accept the message.
+func canMessage(ctx *models.Context, to bson.ObjectId) bool {
+	if ctx == nil || ctx.User == nil {
+		return false
+	}
+	u := &models.User{}
+	if err := ctx.C(U).FindId(to).Select(bson.M{"blocked": 1, "messageprivacy": 1}).One(u); err != nil {
+		return false
+	}
+	return u.AcceptsMessagesFrom(ctx, ctx.User.Id)
+}
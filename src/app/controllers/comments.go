@@ -2,10 +2,49 @@ package controllers
 
 import (
 	"app/models"
+	"errors"
 	"labix.org/v2/mgo/bson"
 	"net/http"
+	"time"
 )
 
+var errNotAdmitted = errors.New("not admitted")
+
+// loadCommenter returns the commented object, not found when the user is
+// not admitted to the contest. The photos keep their comments public
+// whatever contests they are entered in.
+func loadCommenter(ctx *models.Context, kind, id string) (object models.Commenter, err error) {
+	admitted := true
+	switch kind {
+	case models.COMMENT_CONTEST:
+		contest := &models.Contest{}
+		if err = ctx.C(C).FindId(bson.ObjectIdHex(id)).Select(models.AdmitFields).One(&contest); err == nil {
+			admitted = contest.Admits(ctx.User)
+		}
+		object = contest
+	default:
+		photo := &models.Photo{}
+		err = ctx.C(P).FindId(bson.ObjectIdHex(id)).Select(bson.M{"user": 1}).One(&photo)
+		object = photo
+	}
+	if err == nil && !admitted {
+		err = errNotAdmitted
+	}
+	return
+}
+
+// loadComment returns the comment if it belongs to the object in the url.
+func loadComment(ctx *models.Context, req *http.Request) (*models.Comment, error) {
+	c := &models.Comment{}
+	query := bson.M{
+		"_id":    bson.ObjectIdHex(req.URL.Query().Get(":comment")),
+		"kind":   req.URL.Query().Get(":kind"),
+		"target": bson.ObjectIdHex(req.URL.Query().Get(":id")),
+	}
+	err := ctx.C(CM).Find(query).One(c)
+	return c, err
+}
+
 func CommentForm(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 	//set up the collection and query
 	id := req.URL.Query().Get(":id")
@@ -13,32 +52,26 @@ func CommentForm(w http.ResponseWriter, req *http.Request, ctx *models.Context)
 	if !bson.IsObjectIdHex(id) {
 		return perform_status(w, req, http.StatusForbidden)
 	}
-	var object models.Commenter
-	switch kind {
-	case "p":
-		query := ctx.C(P).FindId(bson.ObjectIdHex(id))
-
-		//execute the query
-		photo := &models.Photo{}
-		if err := query.One(&photo); err != nil {
-			return perform_status(w, req, http.StatusNotFound)
-		}
-		object = photo
-	case "c":
-		query := ctx.C(C).FindId(bson.ObjectIdHex(id))
-		//execute the query
-		contest := &models.Contest{}
-		if err := query.One(&contest); err != nil {
-			return perform_status(w, req, http.StatusNotFound)
-		}
-		object = contest
+	object, err := loadCommenter(ctx, kind, id)
+	if err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	max, _ := models.CountThreads(ctx, kind, bson.ObjectIdHex(id))
+	p := NewPagination(max, req.URL.Query())
+	skip := p.PerPage * (p.Current - 1)
+	threads, err := models.LoadThreads(ctx, kind, bson.ObjectIdHex(id), skip, p.PerPage)
+	if err != nil {
+		models.Log("error loading comments: ", err.Error())
 	}
 
 	//execute the template
 	return AJAX("comments.html").Execute(w, map[string]interface{}{
-		"object": object,
-		"kind":   kind,
-		"ctx":    ctx,
+		"id":      id,
+		"object":  object,
+		"threads": threads,
+		"kind":    kind,
+		"p":       p,
+		"ctx":     ctx,
 	})
 }
 
@@ -62,20 +95,130 @@ func Comment(w http.ResponseWriter, req *http.Request, ctx *models.Context) erro
 	if !bson.IsObjectIdHex(id) {
 		return perform_status(w, req, http.StatusForbidden)
 	}
+	kind := req.URL.Query().Get(":kind")
+	object, err := loadCommenter(ctx, kind, id)
+	if err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	topic := models.PhotoTopic(bson.ObjectIdHex(id))
+	if kind == models.COMMENT_CONTEST {
+		topic = models.ContestTopic(bson.ObjectIdHex(id))
+	} else if models.IsBlocked(ctx, object.Owner(), ctx.User.Id) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
 	c := &models.Comment{
-		Id:       bson.NewObjectId(),
-		User:     ctx.User.Id,
-		UserName: ctx.User.FullName(),
-		Avatar:   ctx.User.Avatar,
-		Body:     r.Values["body"],
+		Id:        bson.NewObjectId(),
+		Kind:      kind,
+		Target:    bson.ObjectIdHex(id),
+		User:      ctx.User.Id,
+		UserName:  ctx.User.FullName(),
+		Avatar:    ctx.User.Avatar,
+		Body:      r.Values["body"],
+		CreatedOn: time.Now(),
 	}
-	col := P
-	if req.URL.Query().Get(":kind") == "c" {
-		col = C
+	if replyTo := req.FormValue("reply_to"); bson.IsObjectIdHex(replyTo) {
+		parent := &models.Comment{}
+		if err := ctx.C(CM).Find(bson.M{"_id": bson.ObjectIdHex(replyTo), "target": c.Target}).One(parent); err != nil {
+			return perform_status(w, req, http.StatusNotFound)
+		}
+		// only one level of replies
+		c.ReplyTo = parent.Id
+		if parent.ReplyTo != "" {
+			c.ReplyTo = parent.ReplyTo
+		}
 	}
-	if err := ctx.C(col).UpdateId(bson.ObjectIdHex(id), bson.M{"$push": bson.M{"comments": c}}); err != nil {
+	if err := models.AddComment(ctx, c); err != nil {
 		r.Errors["body"] = err
 		return CommentForm(w, req, ctx)
 	}
+	models.Publish(topic, "comment", map[string]string{
+		"id":   id,
+		"user": c.UserName,
+		"body": c.Body,
+	})
+	return CommentForm(w, req, ctx)
+}
+
+func EditComment(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if !bson.IsObjectIdHex(req.URL.Query().Get(":id")) || !bson.IsObjectIdHex(req.URL.Query().Get(":comment")) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	r := models.CommentForm.Load(req)
+	ctx.Data["result"] = r
+	if len(r.Errors) != 0 {
+		return CommentForm(w, req, ctx)
+	}
+	c, err := loadComment(ctx, req)
+	if err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if !c.CanEdit(ctx.User) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if err := ctx.C(CM).UpdateId(c.Id, bson.M{"$set": bson.M{
+		"body":     r.Values["body"],
+		"editedon": time.Now(),
+	}}); err != nil {
+		models.Log("error editing comment: ", err.Error())
+		r.Errors["body"] = err
+	}
+	return CommentForm(w, req, ctx)
+}
+
+func DeleteComment(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) || !bson.IsObjectIdHex(req.URL.Query().Get(":comment")) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	object, err := loadCommenter(ctx, req.URL.Query().Get(":kind"), id)
+	if err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	c, err := loadComment(ctx, req)
+	if err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if !c.CanDelete(ctx.User, object) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if err := models.RemoveComment(ctx, c); err != nil {
+		models.Log("error deleting comment: ", err.Error())
+	}
+	return CommentForm(w, req, ctx)
+}
+
+func ReportComment(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) || !bson.IsObjectIdHex(req.URL.Query().Get(":comment")) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if _, err := loadCommenter(ctx, req.URL.Query().Get(":kind"), id); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	c, err := loadComment(ctx, req)
+	if err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if err := ctx.C(CM).UpdateId(c.Id, bson.M{"$addToSet": bson.M{"reporters": ctx.User.Id}}); err != nil {
+		models.Log("error reporting comment: ", err.Error())
+	}
 	return CommentForm(w, req, ctx)
 }
@@ -10,6 +10,7 @@ import (
 	"labix.org/v2/mgo/bson"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,10 +19,11 @@ var (
 		"reverse": reverse,
 		"trunc":   truncateString,
 		"trans":   trans,
+		"eq":      eq,
 	}
 	admissionTemplate = template.Must(template.New("adm").Funcs(fm).Parse(`{{ .c.Name }} - {{ if .ctx.User }}<a data-toggle="modal" data-target="#cmo-modal" href="{{ reverse "register_contest" "id" .c.Id.Hex }}"><i class="icon-edit"></i> Enroll in contest</a>{{else}}{{ trans "Login to enroll" .ctx }}{{end}}<p class="indented"><small class="muted">{{trunc .c.Description 160}}</small></p>`))
-	votingTemplate    = template.Must(template.New("vot").Funcs(fm).Parse(`<a data-toggle="modal" data-target="#cmo-modal" href="{{ reverse "view_contest" "id" .c.Id.Hex "photo" "" }}">{{ .c.Name }}</a><p class="indented"><small class="muted">{{trunc .c.Description 160}}</small></p>`))
-	finishedTemplate  = template.Must(template.New("fin").Funcs(fm).Parse(`{{ .c.Name }}<p class="indented"><small class="muted">{{trunc .c.Description 160}}</small></p>`))
+	votingTemplate    = template.Must(template.New("vot").Funcs(fm).Parse(`<a data-toggle="modal" data-target="#cmo-modal" href="{{ reverse "view_contest" "id" .c.Id.Hex "photo" "" }}">{{ .c.Name }}</a>{{ if and .ctx.User (eq .c.Ranking "elo") .c.PublicVoting }} - <a href="{{ reverse "duel" "contest" .c.Id.Hex }}"><i class="icon-random"></i> {{ trans "Head to head" .ctx }}</a>{{ end }}{{ if .ctx.User }}{{ if .c.IsJuror .ctx.User.Id }} - <a href="{{ reverse "jury" "id" .c.Id.Hex }}"><i class="icon-star"></i> {{ trans "Jury" .ctx }}</a>{{ end }}{{ end }}<p class="indented"><small class="muted">{{trunc .c.Description 160}}</small></p>`))
+	finishedTemplate  = template.Must(template.New("fin").Funcs(fm).Parse(`<a href="{{ reverse "contest_results" "id" .c.Id.Hex }}">{{ .c.Name }}</a><p class="indented"><small class="muted">{{trunc .c.Description 160}}</small></p>`))
 )
 
 func ContestForm(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err error) {
@@ -40,6 +42,7 @@ func ContestForm(w http.ResponseWriter, req *http.Request, ctx *models.Context)
 			return perform_status(w, req, http.StatusNotFound)
 		}
 		r, ok := ctx.Data["result"]
+		loc := ctx.Location()
 		v := ""
 		if c.RequireApproval {
 			v = "yes"
@@ -54,16 +57,25 @@ func ContestForm(w http.ResponseWriter, req *http.Request, ctx *models.Context)
 					"gender":             c.Gender,
 					"min_age":            strconv.Itoa(c.MinAge),
 					"max_age":            strconv.Itoa(c.MaxAge),
-					"admission_deadline": c.AdmissionDeadline.Format("2006-01-02"),
-					"voting_deadline":    c.VotingDeadline.Format("2006-01-02"),
+					"admission_deadline": c.AdmissionDeadline.In(loc).Format(models.DEADLINE_DATE),
+					"admission_time":     c.AdmissionDeadline.In(loc).Format(models.DEADLINE_TIME),
+					"voting_deadline":    c.VotingDeadline.In(loc).Format(models.DEADLINE_DATE),
+					"voting_time":        c.VotingDeadline.In(loc).Format(models.DEADLINE_TIME),
 					"require_approval":   v,
+					"ranking":            c.Ranking,
+					"max_entries":        strconv.Itoa(c.EntryLimit()),
+					"min_account_days":   strconv.Itoa(c.MinAccountDays),
+					"judging":            c.JudgingMode(),
+					"jury_weight":        strconv.Itoa(c.JuryWeight),
+					"criteria":           strings.Join(c.Criteria, ", "),
+					"visibility":         c.VisibilityMode(),
 				},
 			}
 			ctx.Data["result"] = r
 		}
 	}
 	var contests []*models.Contest
-	query := bson.M{"user": ctx.User.Id}
+	query := models.OrganizerQuery(ctx.User.Id)
 	max, _ := ctx.C(C).Find(query).Count()
 	p := NewPagination(max, req.URL.Query())
 	skip := p.PerPage * (p.Current - 1)
@@ -72,6 +84,8 @@ func ContestForm(w http.ResponseWriter, req *http.Request, ctx *models.Context)
 
 	return T("contests.html").Execute(w, map[string]interface{}{
 		"ctx":      ctx,
+		"timezone": ctx.Location().String(),
+		"limits":   models.GetContestLimits(ctx),
 		"id":       id,
 		"contests": contests,
 		"p":        p,
@@ -96,20 +110,59 @@ func Contest(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err
 	if gender != "m" && gender != "f" {
 		r.Errors["gender"] = errors.New("Please select Male or Female")
 	}
-	now := time.Now()
-	at := c["admission_deadline"].(time.Time)
-	vt := c["voting_deadline"].(time.Time)
-	if at.Before(now) || at.Equal(now) {
-		r.Errors["admission_deadline"] = errors.New("Must be in the future")
+	// the deadlines are entered in the organizer's timezone and kept in UTC
+	loc := ctx.Location()
+	at, atErr := models.ParseDeadline(c["admission_deadline"].(string), c["admission_time"].(string), loc)
+	vt, vtErr := models.ParseDeadline(c["voting_deadline"].(string), c["voting_time"].(string), loc)
+	// an edited contest keeps the limits from its creation
+	now := time.Now().UTC()
+	nid, created, saved := bson.NewObjectId(), now, time.Time{}
+	if id := req.URL.Query().Get(":id"); bson.IsObjectIdHex(id) { //edit mode
+		nid = bson.ObjectIdHex(id)
+		created = nid.Time()
+		old := &models.Contest{}
+		if err := ctx.C(C).Find(bson.M{"_id": nid, "user": ctx.User.Id}).Select(bson.M{"admissiondeadline": 1}).One(old); err == nil {
+			saved = old.AdmissionDeadline
+		}
+	}
+	if atErr == nil && vtErr == nil {
+		atErr, vtErr = models.GetContestLimits(ctx).CheckDeadlines(at, vt, saved, created, now)
+	}
+	if atErr != nil {
+		r.Errors["admission_deadline"] = atErr
+	}
+	if vtErr != nil {
+		r.Errors["voting_deadline"] = vtErr
+	}
+	if !models.ContestRanking(c["ranking"].(string)) {
+		r.Errors["ranking"] = errors.New("Please select a ranking")
+	}
+	maxEntries, err := optionalInt(c["max_entries"].(string))
+	if err != nil || maxEntries > models.MAX_ENTRIES {
+		r.Errors["max_entries"] = errors.New("Must be a number between 1 and 10")
+	}
+	minAccountDays, err := optionalInt(c["min_account_days"].(string))
+	if err != nil {
+		r.Errors["min_account_days"] = errors.New("Must be a positive number")
 	}
-	if at.After(now.AddDate(0, 1, 1)) {
-		r.Errors["admission_deadline"] = errors.New("Admission deadline can be maximum one month from now")
+	judging := c["judging"].(string)
+	if judging != models.JUDGING_PUBLIC && judging != models.JUDGING_JURY && judging != models.JUDGING_MIXED {
+		r.Errors["judging"] = errors.New("Please select the judging")
 	}
-	if vt.Before(at) || vt.Equal(at) {
-		r.Errors["voting_deadline"] = errors.New("Must be in after admission deadline")
+	juryWeight, err := optionalInt(c["jury_weight"].(string))
+	if err != nil || juryWeight > 100 {
+		r.Errors["jury_weight"] = errors.New("Must be a percent between 0 and 100")
 	}
-	if at.After(now.AddDate(0, 2, 1)) {
-		r.Errors["admission_deadline"] = errors.New("Voting deadline can be maximum two months from now")
+	if judging == models.JUDGING_MIXED && c["jury_weight"].(string) == "" {
+		juryWeight = models.DEFAULT_JURY_WEIGHT
+	}
+	visibility := c["visibility"].(string)
+	if visibility != models.VISIBILITY_PUBLIC && visibility != models.VISIBILITY_UNLISTED && visibility != models.VISIBILITY_INVITE {
+		r.Errors["visibility"] = errors.New("Please select the visibility")
+	}
+	criteria := models.ParseCriteria(c["criteria"].(string))
+	if len(criteria) > models.MAX_CRITERIA {
+		r.Errors["criteria"] = errors.New("Maximum five criteria")
 	}
 	if len(r.Errors) != 0 {
 		return ContestForm(w, req, ctx)
@@ -122,18 +175,20 @@ func Contest(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err
 		Gender:            c["gender"].(string),
 		MinAge:            c["min_age"].(int),
 		MaxAge:            c["max_age"].(int),
-		AdmissionDeadline: c["admission_deadline"].(time.Time),
-		VotingDeadline:    c["voting_deadline"].(time.Time),
+		AdmissionDeadline: at,
+		VotingDeadline:    vt,
 		RequireApproval:   c["require_approval"].(bool),
+		MaxEntries:        maxEntries,
+		MinAccountDays:    minAccountDays,
+		Ranking:           c["ranking"].(string),
+		Judging:           judging,
+		JuryWeight:        juryWeight,
+		Criteria:          criteria,
+		Visibility:        visibility,
 		Public:            false,
+		State:             models.STATE_DRAFT,
 		User:              ctx.User.Id,
 	}
-	var nid bson.ObjectId
-	if id := req.URL.Query().Get(":id"); bson.IsObjectIdHex(id) { //edit mode
-		nid = bson.ObjectIdHex(id)
-	} else {
-		nid = bson.NewObjectId()
-	}
 	query := bson.M{"_id": nid, "user": ctx.User.Id, "public": false}
 	if _, err := ctx.C(C).Upsert(query, bson.M{"$set": contest}); err != nil {
 		ctx.Session.AddFlash(models.F(models.ERROR, trans("Problem updating contest:", ctx), err.Error()))
@@ -142,11 +197,44 @@ func Contest(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err
 		r.Err = err // for pnotify
 		return ContestForm(w, req, ctx)
 	}
+	if visibility == models.VISIBILITY_INVITE {
+		// keep the code of the links already shared
+		ctx.C(C).Update(bson.M{"_id": nid, "invitecode": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"invitecode": models.NewInviteCode()}})
+	}
 	ctx.Session.AddFlash(models.F(models.SUCCESS, trans("Contest updated succesully!", ctx)))
 	http.Redirect(w, req, reverse("contest", "id", ""), http.StatusSeeOther)
 	return nil
 }
 
+// optionalInt parses a positive number that can be left empty.
+func optionalInt(s string) (int, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err == nil && n < 0 {
+		err = errors.New("negative number")
+	}
+	return n, err
+}
+
+// contestFor loads the contest of the url if the user has the permission
+// on it.
+func contestFor(req *http.Request, ctx *models.Context, perm string) *models.Contest {
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return nil
+	}
+	contest := &models.Contest{}
+	if err := ctx.C(C).FindId(bson.ObjectIdHex(id)).One(contest); err != nil {
+		return nil
+	}
+	if !contest.Allows(ctx.User.Id, perm) {
+		return nil
+	}
+	return contest
+}
+
 func DeleteContest(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err error) {
 	if ctx.User == nil {
 		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
@@ -156,9 +244,13 @@ func DeleteContest(w http.ResponseWriter, req *http.Request, ctx *models.Context
 		return perform_status(w, req, http.StatusForbidden)
 	}
 
-	did := bson.ObjectIdHex(req.URL.Query().Get(":id"))
+	contest := contestFor(req, ctx, models.PERM_EDIT)
+	if contest == nil || contest.Public {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	did := contest.Id
 	// delete from db
-	query := bson.M{"_id": did, "user": ctx.User.Id}
+	query := bson.M{"_id": did, "user": ctx.User.Id, "public": false}
 
 	if err := ctx.C(C).Remove(query); err != nil {
 		return perform_status(w, req, http.StatusNotFound)
@@ -169,30 +261,53 @@ func DeleteContest(w http.ResponseWriter, req *http.Request, ctx *models.Context
 	if _, err := ctx.C(V).UpdateAll(query, bson.M{"$unset": bson.M{"contest": 1}}); err != nil {
 		models.Log("Error cleaning votes on contest delete: ", err.Error())
 	}
+	if _, err := ctx.C(CM).RemoveAll(bson.M{"kind": models.COMMENT_CONTEST, "target": did}); err != nil {
+		models.Log("Error deleting comments on contest delete: ", err.Error())
+	}
 
 	http.Redirect(w, req, reverse("contest", "id", ""), http.StatusSeeOther)
 	return nil
 }
 
+// candidate is a photo of the user with the reasons it cannot enter the
+// contest.
+type candidate struct {
+	*models.Photo
+	Reasons []string
+}
+
 func RegisterContestForm(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err error) {
 	if ctx.User == nil {
 		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
 		return nil
 	}
 	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return perform_status(w, req, http.StatusNotFound)
+	}
 	contest := &models.Contest{}
 	if err := ctx.C(C).FindId(bson.ObjectIdHex(id)).One(contest); err != nil {
 		return perform_status(w, req, http.StatusNotFound)
 	}
+	if !contest.Admits(ctx.User) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
 
 	var photos []*models.Photo
 	if err := ctx.C(P).Find(bson.M{"user": ctx.User.Id, "active": true}).All(&photos); err != nil {
 		return perform_status(w, req, http.StatusNotFound)
 	}
+	candidates := make([]*candidate, len(photos))
+	for i, p := range photos {
+		candidates[i] = &candidate{p, contest.PhotoIneligibility(p)}
+	}
 	return AJAX("register_contest.html").Execute(w, map[string]interface{}{
-		"contest": contest,
-		"photos":  photos,
-		"ctx":     ctx,
+		"contest":    contest,
+		"candidates": candidates,
+		"reasons":    contest.UserIneligibility(ctx.User),
+		"entries":    contest.Entries(ctx.User.Id),
+		"rejected":   contest.Rejections(ctx.User.Id),
+		"ctx":        ctx,
 	})
 }
 
@@ -215,12 +330,33 @@ func RegisterContest(w http.ResponseWriter, req *http.Request, ctx *models.Conte
 		return perform_status(w, req, http.StatusNotFound)
 	}
 	photo := &models.Photo{}
-	if err := ctx.C(P).FindId(bson.ObjectIdHex(photoId)).One(photo); err != nil {
+	if err := ctx.C(P).Find(bson.M{"_id": bson.ObjectIdHex(photoId), "user": ctx.User.Id}).One(photo); err != nil {
 		return perform_status(w, req, http.StatusNotFound)
 	}
-	if !contest.CanRegister() {
+	if !contest.CanRegister() || !contest.Admits(ctx.User) {
 		return perform_status(w, req, http.StatusForbidden)
 	}
+	// the entry given to be replaced makes room for the new photo
+	var replaced *models.RegItem
+	if r := req.FormValue("replace"); bson.IsObjectIdHex(r) {
+		if replaced = contest.Entry(ctx.User.Id, bson.ObjectIdHex(r)); replaced == nil || !contest.CanWithdraw() {
+			return perform_status(w, req, http.StatusForbidden)
+		}
+	}
+	reasons := contest.PhotoIneligibility(photo)
+	if contest.Rejected(photo.Id) {
+		reasons = append(reasons, models.INELIGIBLE_REJECTED)
+	}
+	if replaced == nil && !contest.Entered(photo.Id) {
+		reasons = append(reasons, contest.UserIneligibility(ctx.User)...)
+	} else if replaced != nil && replaced.Photo != photo.Id && contest.Entered(photo.Id) {
+		reasons = append(reasons, models.INELIGIBLE_ENTERED)
+	}
+	if len(reasons) > 0 {
+		ctx.Session.AddFlash(models.F(models.ERROR, trans("The photo cannot enter the contest:", ctx), trans(reasons[0], ctx)))
+		http.Redirect(w, req, reverse("index"), http.StatusSeeOther)
+		return nil
+	}
 
 	ri := &models.RegItem{
 		User:        ctx.User.Id,
@@ -229,12 +365,29 @@ func RegisterContest(w http.ResponseWriter, req *http.Request, ctx *models.Conte
 		Photo:       photo.Id,
 		Title:       photo.Title,
 		Description: photo.Description,
-		Approved:    !contest.RequireApproval || contest.User == ctx.User.Id,
+		Approved:    !contest.RequireApproval || contest.Allows(ctx.User.Id, models.PERM_APPROVE),
+	}
+	// a single entry is replaced, several are told apart by photo, the
+	// rejected ones are kept
+	field, value := "user", ctx.User.Id
+	if replaced != nil {
+		field, value = "photo", replaced.Photo
+	} else if contest.EntryLimit() > 1 {
+		field, value = "photo", photo.Id
+	}
+	entry := bson.M{"$elemMatch": bson.M{field: value, "rejected": bson.M{"$ne": true}}}
+	query := bson.M{"_id": contest.Id, "registered": bson.M{"$not": entry}}
+	if field == "photo" && replaced == nil {
+		for k, v := range contest.EntriesLeft(ctx.User.Id) {
+			query[k] = v
+		}
 	}
-	query := bson.M{"_id": contest.Id, "registered.user": bson.M{"$ne": ctx.User.Id}}
-	if err := ctx.C(C).Update(query, bson.M{"$push": bson.M{"registered": ri}}); err != nil {
+	if err := ctx.C(C).Update(query, bson.M{
+		"$push": bson.M{"registered": ri},
+		"$inc":  models.CountEntries(ctx.User.Id, 1),
+	}); err != nil {
 		// allready in
-		query := bson.M{"_id": contest.Id, "registered.user": ctx.User.Id}
+		query := bson.M{"_id": contest.Id, "registered": entry}
 		if err = ctx.C(C).Update(query, bson.M{"$set": bson.M{
 			"registered.$.photo":       ri.Photo,
 			"registered.$.title":       ri.Title,
@@ -242,6 +395,14 @@ func RegisterContest(w http.ResponseWriter, req *http.Request, ctx *models.Conte
 			"registered.$.approved":    ri.Approved,
 		}}); err != nil {
 			models.Log("error updating contest registered list: ", err.Error())
+			// the entries left were taken since the form was loaded
+			reason := trans("Please try again.", ctx)
+			if replaced == nil {
+				reason = trans(models.INELIGIBLE_MAX_ENTRIES, ctx)
+			}
+			ctx.Session.AddFlash(models.F(models.ERROR, trans("The photo cannot enter the contest:", ctx), reason))
+			http.Redirect(w, req, reverse("index"), http.StatusSeeOther)
+			return nil
 		}
 	}
 
@@ -250,21 +411,34 @@ func RegisterContest(w http.ResponseWriter, req *http.Request, ctx *models.Conte
 	return nil
 }
 
-func PendingApprovals(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err error) {
+func WithdrawContest(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err error) {
 	if ctx.User == nil {
 		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
 		return nil
 	}
-	id := req.URL.Query().Get(":id")
-	if !bson.IsObjectIdHex(id) {
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
 		return perform_status(w, req, http.StatusForbidden)
 	}
-	contest := &models.Contest{}
-	if err := ctx.C(C).FindId(bson.ObjectIdHex(id)).One(contest); err != nil {
+	id, photo := req.URL.Query().Get(":id"), req.URL.Query().Get(":photo")
+	if !bson.IsObjectIdHex(id) || !bson.IsObjectIdHex(photo) {
 		return perform_status(w, req, http.StatusNotFound)
 	}
-	// check user owns contest
-	if contest.User != ctx.User.Id {
+	if err := models.WithdrawEntry(ctx, bson.ObjectIdHex(id), ctx.User.Id, bson.ObjectIdHex(photo)); err != nil {
+		ctx.Session.AddFlash(models.F(models.ERROR, trans("The photo cannot be withdrawn, it is not entered or the admission is over.", ctx)))
+	} else {
+		ctx.Session.AddFlash(models.F(models.SUCCESS, trans("The photo was withdrawn from the contest.", ctx)))
+	}
+	http.Redirect(w, req, reverse("index"), http.StatusSeeOther)
+	return nil
+}
+
+func PendingApprovals(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err error) {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	contest := contestFor(req, ctx, models.PERM_APPROVE)
+	if contest == nil {
 		return perform_status(w, req, http.StatusForbidden)
 	}
 	return AJAX("pending_approval.html").Execute(w, map[string]interface{}{
@@ -279,50 +453,56 @@ func ContestStatus(w http.ResponseWriter, req *http.Request, ctx *models.Context
 		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
 		return nil
 	}
-	id := req.URL.Query().Get(":id")
-	if !bson.IsObjectIdHex(id) {
+	contest := contestFor(req, ctx, models.PERM_STATUS)
+	if contest == nil {
 		return perform_status(w, req, http.StatusForbidden)
 	}
-	contest := &models.Contest{}
-	if err := ctx.C(C).FindId(bson.ObjectIdHex(id)).One(contest); err != nil {
-		return perform_status(w, req, http.StatusNotFound)
-	}
-	// check user owns contest
-	if contest.User != ctx.User.Id {
-		return perform_status(w, req, http.StatusForbidden)
+	standings, err := contest.Standings(ctx)
+	if err != nil {
+		models.Log("error ranking contest: ", err.Error())
 	}
 	return AJAX("contest_status.html").Execute(w, map[string]interface{}{
-		"contest": contest,
-		"ctx":     ctx,
+		"contest":   contest,
+		"standings": standings,
+		"manage":    contest.Allows(ctx.User.Id, models.PERM_MANAGE),
+		"ctx":       ctx,
 	})
 	return nil
 }
 
+// ApproveContest approves or rejects the selected entries, the rejected
+// entrants get the reason in a message.
 func ApproveContest(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 	if ctx.User == nil {
 		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
 		return nil
 	}
-	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
 		return perform_status(w, req, http.StatusForbidden)
 	}
-	id := req.URL.Query().Get(":id")
-	userId := req.URL.Query().Get(":user")
-	if !bson.IsObjectIdHex(id) || !bson.IsObjectIdHex(userId) {
+	contest := contestFor(req, ctx, models.PERM_APPROVE)
+	if contest == nil || contest.Finished() {
 		return perform_status(w, req, http.StatusForbidden)
 	}
-	// TODO: veryfy if contest belongs to the ctx.User
-
-	res := req.URL.Query().Get(":res")
-	switch res {
+	req.ParseForm()
+	var photos []bson.ObjectId
+	for _, p := range req.Form["photo"] {
+		if bson.IsObjectIdHex(p) {
+			photos = append(photos, bson.ObjectIdHex(p))
+		}
+	}
+	switch req.FormValue("res") {
 	case "y":
-		query := bson.M{"_id": bson.ObjectIdHex(id), "registered.user": bson.ObjectIdHex(userId)}
-		ctx.C(C).Update(query, bson.M{"$set": bson.M{"registered.$.approved": true}})
+		n := models.ApproveEntries(ctx, contest, photos, ctx.User.Id)
+		ctx.Session.AddFlash(models.F(models.SUCCESS, trans("Entries approved:", ctx), strconv.Itoa(n)))
 	case "n":
-		// removing from registered list
-		ctx.C(C).UpdateId(bson.ObjectIdHex(id), bson.M{"$pull": bson.M{"registered": bson.M{"user": bson.ObjectIdHex(userId)}}})
+		reason := strings.TrimSpace(req.FormValue("reason"))
+		n := models.RejectEntries(ctx, contest, photos, reason, ctx.User.Id)
+		ctx.Session.AddFlash(models.F(models.SUCCESS, trans("Entries rejected:", ctx), strconv.Itoa(n)))
+	default:
+		return perform_status(w, req, http.StatusForbidden)
 	}
-	return nil
+	return PendingApprovals(w, req, ctx)
 }
 
 func PublishContest(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
@@ -333,11 +513,11 @@ func PublishContest(w http.ResponseWriter, req *http.Request, ctx *models.Contex
 	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
 		return perform_status(w, req, http.StatusForbidden)
 	}
-	id := req.URL.Query().Get(":id")
-	if !bson.IsObjectIdHex(id) {
+	contest := contestFor(req, ctx, models.PERM_EDIT)
+	if contest == nil {
 		return perform_status(w, req, http.StatusForbidden)
 	}
-	if err := ctx.C(C).UpdateId(bson.ObjectIdHex(id), bson.M{"$set": bson.M{"public": true}}); err != nil {
+	if err := models.PublishContest(ctx, contest.Id, ctx.User.Id); err != nil {
 		models.Log("error making contest public: ", err.Error())
 		ctx.Session.AddFlash(models.F(models.ERROR, trans("Failed to make project public: ", ctx), err.Error()))
 	} else {
@@ -353,36 +533,95 @@ func ViewContest(w http.ResponseWriter, req *http.Request, ctx *models.Context)
 		return perform_status(w, req, http.StatusForbidden)
 	}
 	contest := &models.Contest{}
-	ctx.C(C).FindId(bson.ObjectIdHex(id)).One(contest)
+	if err := ctx.C(C).FindId(bson.ObjectIdHex(id)).One(contest); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if !contest.Admits(ctx.User) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
 	ctx.Data["index"] = 0
 	return AJAX("galleria.html").Execute(w, map[string]interface{}{
-		"photos":  contest.Registered,
+		"photos":    contest.Competing(),
+		"contest":   contest,
+		"jury_only": !contest.PublicVoting(),
+		"hash":      models.GenUUID(),
+		"ctx":       ctx,
+	})
+	return nil
+}
+
+// ContestResults shows the podium and the final standings of a finished
+// contest.
+func ContestResults(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	contest := &models.Contest{}
+	if err := ctx.C(C).FindId(bson.ObjectIdHex(id)).One(contest); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if !contest.Admits(ctx.User) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if !contest.Finished() {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	// until the scheduler closes it the standings are shown unsaved
+	if !contest.Closed() {
+		results, err := contest.FinalStandings(ctx)
+		if err != nil {
+			return internal_error(w, req, err.Error())
+		}
+		contest.Results = results
+	}
+	return T("results.html").Execute(w, map[string]interface{}{
 		"contest": contest,
-		"hash":    models.GenUUID(),
 		"ctx":     ctx,
 	})
+}
+
+// JoinContest adds the user to the invite only contest of the invitation
+// link.
+func JoinContest(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	contest := &models.Contest{}
+	if err := ctx.C(C).FindId(bson.ObjectIdHex(id)).One(contest); err != nil || !contest.Public {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if err := models.JoinWithCode(ctx, contest, ctx.User, req.URL.Query().Get(":code")); err != nil {
+		ctx.Session.AddFlash(models.F(models.ERROR, trans("The invitation is not valid.", ctx)))
+	} else {
+		ctx.Session.AddFlash(models.F(models.SUCCESS, trans("You joined the contest", ctx), contest.Name))
+	}
+	http.Redirect(w, req, reverse("index"), http.StatusSeeOther)
 	return nil
 }
 
 func ContestList(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 	var contests []*models.Contest
-	query := bson.M{"public": true}
-	if f, ok := ctx.Session.Values["filter"]; ok {
-		f.(*models.Filter).AddContestQuery(query)
+	query := models.ListedQuery(ctx.User)
+	if f := activeFilter(req, ctx); f != nil {
+		f.AddContestQuery(query)
 	}
 	list := req.URL.Query().Get(":list")
-	now := time.Now()
 	var t *template.Template
 	switch list {
 	case "adm":
-		query["admissiondeadline"] = bson.M{"$gt": now}
+		query["state"] = models.STATE_ADMISSION
 		t = admissionTemplate
 	case "vot":
-		query["admissiondeadline"] = bson.M{"$lt": now}
-		query["votingdeadline"] = bson.M{"$gt": now}
+		query["state"] = models.STATE_VOTING
 		t = votingTemplate
 	case "fin":
-		query["votingdeadline"] = bson.M{"$lt": now}
+		query["state"] = bson.M{"$in": []string{models.STATE_CLOSED, models.STATE_RESULTS}}
 		t = finishedTemplate
 	case "pop":
 
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"app/models"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+)
+
+type duelChoice struct {
+	Photo, Other *models.Photo
+}
+
+type duelRank struct {
+	*models.Photo
+	Rating float64
+	Games  int
+}
+
+// duelQuery selects the photos the user can compare, the ones matching the
+// filter or the approved entries of a contest open for voting.
+func duelQuery(req *http.Request, ctx *models.Context, contestId string) (query bson.M, contest *models.Contest, ok bool) {
+	query = bson.M{"active": true, "user": bson.M{"$ne": ctx.User.Id}}
+	if contestId == "" {
+		if f := activeFilter(req, ctx); f != nil {
+			f.AddQuery(query)
+		}
+		return query, nil, true
+	}
+	if !bson.IsObjectIdHex(contestId) {
+		return nil, nil, false
+	}
+	contest = &models.Contest{}
+	if err := ctx.C(C).FindId(bson.ObjectIdHex(contestId)).One(contest); err != nil || !contest.CanVote() || !contest.PublicVoting() || !contest.Admits(ctx.User) {
+		return nil, nil, false
+	}
+	var ids []bson.ObjectId
+	for _, ri := range contest.Registered {
+		if ri.Approved {
+			ids = append(ids, ri.Photo)
+		}
+	}
+	query["_id"] = bson.M{"$in": ids}
+	return query, contest, true
+}
+
+// Duel shows two photos side by side for the user to pick the better one.
+func Duel(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	query, contest, ok := duelQuery(req, ctx, req.URL.Query().Get(":contest"))
+	if !ok {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	pair, err := models.DuelPair(ctx, query)
+	if err != nil {
+		return internal_error(w, req, err.Error())
+	}
+	var choices []duelChoice
+	if len(pair) == 2 {
+		choices = []duelChoice{{pair[0], pair[1]}, {pair[1], pair[0]}}
+	}
+	return T("duel.html").Execute(w, map[string]interface{}{
+		"pair":       choices,
+		"contest":    contest,
+		"contest_id": req.URL.Query().Get(":contest"),
+		"ctx":        ctx,
+	})
+}
+
+// Prefer records the photo picked in a duel.
+func Prefer(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	contestId := req.URL.Query().Get(":contest")
+	query, contest, ok := duelQuery(req, ctx, contestId)
+	if !ok {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	winner, loser := req.FormValue("winner"), req.FormValue("loser")
+	if !bson.IsObjectIdHex(winner) || !bson.IsObjectIdHex(loser) || winner == loser {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	d := &models.Duel{
+		User:   ctx.User.Id,
+		Winner: bson.ObjectIdHex(winner),
+		Loser:  bson.ObjectIdHex(loser),
+	}
+	if contest != nil {
+		d.Contest = contest.Id
+	}
+	// both photos must be eligible for the duel
+	query["$and"] = []bson.M{{"_id": bson.M{"$in": []bson.ObjectId{d.Winner, d.Loser}}}}
+	if n, _ := ctx.C(P).Find(query).Count(); n != 2 {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if err := models.RecordDuel(ctx, d); err != nil {
+		models.Log("duel err: ", err.Error())
+	}
+	http.Redirect(w, req, reverse("duel", "contest", contestId), http.StatusSeeOther)
+	return nil
+}
+
+// DuelRankings lists the photos by their head to head rating.
+func DuelRankings(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	p := NewPagination(0, req.URL.Query())
+	skip := p.PerPage * (p.Current - 1)
+	ranked, max, err := models.EloRanking(ctx, "", skip, p.PerPage)
+	if err != nil {
+		return internal_error(w, req, err.Error())
+	}
+	p.Max = max
+	ids := make([]bson.ObjectId, len(ranked))
+	for i, r := range ranked {
+		ids[i] = r.Photo
+	}
+	var found []*models.Photo
+	if err := ctx.C(P).Find(bson.M{"_id": bson.M{"$in": ids}, "active": true}).All(&found); err != nil {
+		return internal_error(w, req, err.Error())
+	}
+	byId := make(map[bson.ObjectId]*models.Photo, len(found))
+	for _, ph := range found {
+		byId[ph.Id] = ph
+	}
+	var photos []duelRank
+	for _, r := range ranked {
+		if ph, ok := byId[r.Photo]; ok {
+			photos = append(photos, duelRank{ph, r.Rank, r.Count})
+		}
+	}
+	return AJAX("duel_rankings.html").Execute(w, map[string]interface{}{
+		"photos": photos,
+		"p":      p,
+		"ctx":    ctx,
+	})
+}
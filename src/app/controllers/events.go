@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"app/models"
+	"encoding/json"
+	"fmt"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"time"
+)
+
+const KEEP_ALIVE = 30 * time.Second
+
+// Events streams the subscribed topics as server-sent events. It is not
+// wrapped in Handler because the response can not be buffered or gzipped.
+func Events(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ctx, err := models.NewContext(req)
+	if err != nil {
+		http.Error(w, "new context err", http.StatusInternalServerError)
+		return
+	}
+	topics := []string{models.CONTESTS_TOPIC}
+	if ctx.User != nil {
+		topics = append(topics, models.UserTopic(ctx.User.Id))
+	}
+	if id := req.FormValue("photo"); bson.IsObjectIdHex(id) {
+		photo := &models.Photo{}
+		if err := ctx.C(P).FindId(bson.ObjectIdHex(id)).Select(bson.M{"_id": 1}).One(photo); err == nil {
+			topics = append(topics, models.PhotoTopic(photo.Id))
+		}
+	}
+	if id := req.FormValue("contest"); bson.IsObjectIdHex(id) {
+		contest := &models.Contest{}
+		if err := ctx.C(C).FindId(bson.ObjectIdHex(id)).Select(models.AdmitFields).One(contest); err == nil && contest.Admits(ctx.User) {
+			topics = append(topics, models.ContestTopic(contest.Id))
+		}
+	}
+	// no need to keep the db session for the lifetime of the stream
+	ctx.Close()
+
+	ch := models.Events.Subscribe(topics...)
+	defer models.Events.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	ticker := time.NewTicker(KEEP_ALIVE)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				models.Log("error encoding event: ", err.Error())
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, data)
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
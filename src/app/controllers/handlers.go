@@ -3,6 +3,7 @@ package controllers
 import (
 	"app/models"
 	"fmt"
+	"labix.org/v2/mgo/bson"
 	"net/http"
 )
 
@@ -10,8 +11,13 @@ func Index(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err e
 	if _, ok := ctx.Session.Values["lang"]; !ok {
 		detectLanguage(req.Header["Accept-Language"], ctx)
 	}
+	share := ""
+	if f := activeFilter(req, ctx); f != nil && !f.Empty() {
+		share = reverse("index") + "?" + f.Query()
+	}
 	return T("index.html").Execute(w, map[string]interface{}{
-		"ctx": ctx,
+		"share": share,
+		"ctx":   ctx,
 	})
 }
 
@@ -35,6 +41,25 @@ func SetLanguage(w http.ResponseWriter, req *http.Request, ctx *models.Context)
 	return nil
 }
 
+// SetTimezone keeps the timezone detected by the browser to show the times
+// in it.
+func SetTimezone(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	loc, err := models.LoadTimezone(req.FormValue("tz"))
+	if err != nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	ctx.Session.Values["timezone"] = loc.String()
+	if ctx.User != nil {
+		if err := ctx.C(U).UpdateId(ctx.User.Id, bson.M{"$set": bson.M{"timezone": loc.String()}}); err != nil {
+			models.Log("error saving user timezone: ", err.Error())
+		}
+	}
+	return nil
+}
+
 func ContactForm(w http.ResponseWriter, req *http.Request, ctx *models.Context) (err error) {
 	return T("contact.html").Execute(w, map[string]interface{}{
 		"ctx": ctx,
@@ -12,13 +12,16 @@ import (
 )
 
 const (
-	P              = "photos"
-	V              = "votes"
-	U              = "users"
-	C              = "contests"
-	M              = "messages"
-	PT             = "passwordtokens"
-	ITEMS_PER_PAGE = 20
+	P                  = "photos"
+	V                  = "votes"
+	U                  = "users"
+	C                  = "contests"
+	M                  = "messages"
+	CM                 = "comments"
+	PT                 = "passwordtokens"
+	S                  = "series"
+	ITEMS_PER_PAGE     = 20
+	RANKINGS_PER_GROUP = 5
 )
 
 var (
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"app/models"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"strconv"
+)
+
+// juryEntry is an approved entry with the marks of the juror.
+type juryEntry struct {
+	*models.RegItem
+	Scores []float64
+}
+
+// Mark returns the mark for the i-th criterion, zero when not scored.
+func (e *juryEntry) Mark(i int) int {
+	if i >= len(e.Scores) {
+		return 0
+	}
+	return int(e.Scores[i])
+}
+
+// Jury shows the entries to the juror with the marks given so far.
+func Jury(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	contest, ok := juryContest(req, ctx)
+	if !ok {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	scores, err := models.JurorScores(ctx, contest.Id, ctx.User.Id)
+	if err != nil {
+		return internal_error(w, req, err.Error())
+	}
+	var entries []*juryEntry
+	for _, ri := range contest.Registered {
+		if !ri.Approved || ri.User == ctx.User.Id {
+			continue
+		}
+		e := &juryEntry{RegItem: ri}
+		if js, ok := scores[ri.Photo]; ok {
+			e.Scores = js.Scores
+		}
+		entries = append(entries, e)
+	}
+	return T("jury.html").Execute(w, map[string]interface{}{
+		"contest": contest,
+		"entries": entries,
+		"marks":   []int{1, 2, 3, 4, 5},
+		"ctx":     ctx,
+	})
+}
+
+// ScoreEntry saves the marks of the juror for one entry.
+func ScoreEntry(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	contest, ok := juryContest(req, ctx)
+	photo := req.URL.Query().Get(":photo")
+	if !ok || !bson.IsObjectIdHex(photo) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	js := &models.JuryScore{Contest: contest.Id, Photo: bson.ObjectIdHex(photo), Juror: ctx.User.Id}
+	ri := contest.PhotoEntry(js.Photo)
+	if ri == nil || !ri.Approved || ri.User == ctx.User.Id {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	for i := range contest.JudgingCriteria() {
+		mark, err := strconv.ParseFloat(req.FormValue("c"+strconv.Itoa(i)), 64)
+		if err != nil || mark < models.MIN_MARK || mark > models.MAX_MARK {
+			return perform_status(w, req, http.StatusForbidden)
+		}
+		js.Scores = append(js.Scores, mark)
+	}
+	if err := models.ScoreEntry(ctx, js); err != nil {
+		return internal_error(w, req, err.Error())
+	}
+	ctx.Session.AddFlash(models.F(models.SUCCESS, trans("Your marks were saved.", ctx)))
+	http.Redirect(w, req, reverse("jury", "id", contest.Id.Hex()), http.StatusSeeOther)
+	return nil
+}
+
+// juryContest loads the contest of the url if the user can score it.
+func juryContest(req *http.Request, ctx *models.Context) (*models.Contest, bool) {
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return nil, false
+	}
+	contest := &models.Contest{}
+	if err := ctx.C(C).FindId(bson.ObjectIdHex(id)).One(contest); err != nil {
+		return nil, false
+	}
+	return contest, contest.HasJury() && contest.CanVote() && contest.IsJuror(ctx.User.Id)
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"app/models"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+)
+
+// memberRole adds and removes the users with a part in the contest.
+type memberRole struct {
+	add     func(ctx *models.Context, c *models.Contest, u *models.User) error
+	remove  func(ctx *models.Context, contest, user bson.ObjectId) error
+	added   string
+	refused string
+}
+
+var memberRoles = map[string]*memberRole{
+	"organizer": {models.AddOrganizer, models.RemoveOrganizer, "The user was invited to organize the contest.", "The user cannot be an organizer."},
+	"juror":     {models.AddJuror, models.RemoveJuror, "The user was invited in the jury.", "The user is already in the jury."},
+	"invited":   {models.InviteUser, models.UninviteUser, "The user was invited in the contest.", "The user is already invited."},
+}
+
+// AddMember gives the user picked with the user search a role in the
+// contest.
+func AddMember(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	role, ok := memberRoles[req.URL.Query().Get(":role")]
+	contest := contestFor(req, ctx, models.PERM_MANAGE)
+	if !ok || contest == nil || contest.Closed() {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	userId := req.FormValue("user")
+	if !bson.IsObjectIdHex(userId) {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	member := &models.User{}
+	if err := ctx.C(U).FindId(bson.ObjectIdHex(userId)).One(member); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if err := role.add(ctx, contest, member); err != nil {
+		ctx.Session.AddFlash(models.F(models.ERROR, trans(role.refused, ctx)))
+	} else {
+		ctx.Session.AddFlash(models.F(models.SUCCESS, trans(role.added, ctx)))
+	}
+	http.Redirect(w, req, reverse("contest", "id", ""), http.StatusSeeOther)
+	return nil
+}
+
+func DelMember(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	role, ok := memberRoles[req.URL.Query().Get(":role")]
+	contest := contestFor(req, ctx, models.PERM_MANAGE)
+	userId := req.URL.Query().Get(":user")
+	if !ok || contest == nil || contest.Closed() || !bson.IsObjectIdHex(userId) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if err := role.remove(ctx, contest.Id, bson.ObjectIdHex(userId)); err != nil {
+		models.Log("error removing contest member: ", err.Error())
+	}
+	http.Redirect(w, req, reverse("contest", "id", ""), http.StatusSeeOther)
+	return nil
+}
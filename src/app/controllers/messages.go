@@ -34,6 +34,13 @@ func SendMessage(w http.ResponseWriter, req *http.Request, ctx *models.Context)
 	if to == ctx.User.Id.Hex() {
 		return perform_status(w, req, http.StatusForbidden)
 	}
+	recipient := &models.User{}
+	if err := ctx.C(U).FindId(bson.ObjectIdHex(to)).One(recipient); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if !recipient.AcceptsMessagesFrom(ctx, ctx.User.Id) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
 	m := models.Message{
 		Id:       bson.NewObjectId(),
 		From:     ctx.User.Id,
@@ -45,7 +52,12 @@ func SendMessage(w http.ResponseWriter, req *http.Request, ctx *models.Context)
 	}
 	if err := ctx.C(M).Insert(m); err != nil {
 		models.Log("Error sending message: ", err.Error())
+		return nil
 	}
+	models.Publish(models.UserTopic(m.To), "new_message", map[string]string{
+		"from":    m.UserName,
+		"subject": m.Subject,
+	})
 	return nil
 }
 
@@ -55,10 +67,19 @@ func Messages(w http.ResponseWriter, req *http.Request, ctx *models.Context) err
 		return nil
 	}
 	var messages []*models.Message
-	ctx.C(M).Find(bson.M{"to": ctx.User.Id}).All(&messages)
+	query := bson.M{"to": ctx.User.Id}
+	if len(ctx.User.Blocked) > 0 {
+		query["from"] = bson.M{"$nin": ctx.User.Blocked}
+	}
+	ctx.C(M).Find(query).All(&messages)
+	var blocked []*models.User
+	if len(ctx.User.Blocked) > 0 {
+		ctx.C(U).Find(bson.M{"_id": bson.M{"$in": ctx.User.Blocked}}).Select(bson.M{"firstname": 1, "lastname": 1, "avatar": 1}).All(&blocked)
+	}
 	return T("messages.html").Execute(w, map[string]interface{}{
 		"ctx":      ctx,
 		"messages": messages,
+		"blocked":  blocked,
 	})
 }
 
@@ -3,27 +3,24 @@ package controllers
 import (
 	"app/models"
 	"bytes"
-	crand "crypto/rand"
 	"fmt"
 	"github.com/rif/forms"
 	"html/template"
 	"image/jpeg"
 	"labix.org/v2/mgo/bson"
-	"math/big"
-	"math/rand"
 	"net/http"
 	"os"
 	"path"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 var layerTemplate = template.Must(template.New("").Funcs(template.FuncMap{
-	"reverse": reverse,
-	"neq":     neq,
-	"trans":   trans,
+	"reverse":     reverse,
+	"neq":         neq,
+	"trans":       trans,
+	"can_message": canMessage,
 }).Parse(`
 <div>
 <p class='galleria-info-title'>{{.p.Title}}</p>
@@ -41,12 +38,17 @@ var layerTemplate = template.Must(template.New("").Funcs(template.FuncMap{
 {{ if neq .ctx.User.Id .p.User }}
 <a tip='{{ trans "Fake" .ctx }}' id='fake-link' class='btn btn-mini btn-link' href='{{ reverse "fake" "photo" .p.Id.Hex "csrf_token" .ctx.Session.Values.csrf_token }}'><i class='icon-white icon-thumbs-down'></i></a>
 <a tip='{{ trans "Abuse" .ctx }}' id='abuse-link' class='btn btn-mini btn-link' href='{{ reverse "abuse" "photo" .p.Id.Hex  "csrf_token" .ctx.Session.Values.csrf_token }}'><i class='icon-white icon-fire'></i></a>
+{{ if can_message .ctx .p.User }}
 <a tip='{{ trans "Message" .ctx }}' id='mes-link' href='{{ reverse "send_message" "to" .p.User.Hex}}' class='btn btn-link btn-mini'><i class='icon-white icon-comment'></i></a>
 {{ end }}
+<a tip='{{ trans "Block" .ctx }}' id='block-link' href='{{ reverse "block" "user" .p.User.Hex "csrf_token" .ctx.Session.Values.csrf_token }}' class='btn btn-link btn-mini'><i class='icon-white icon-ban-circle'></i></a>
+{{ end }}
 {{ end }}
 </span>
 <span class='muted' id='tip'></span>
+<span class='muted' id='live-votes'></span>
 <a style='display:none;' class='comment-link' href='{{ reverse "comments" "kind" "p" "id" .p.Id.Hex }}'></a>
+<a style='display:none;' class='view-link' href='{{ reverse "view" "photo" .p.Id.Hex "csrf_token" .ctx.Session.Values.csrf_token }}'></a>
 </div>
 `))
 
@@ -132,10 +134,6 @@ func Upload(w http.ResponseWriter, req *http.Request, ctx *models.Context) error
 		return UploadForm(w, req, ctx)
 	}
 	p := r.Value.(map[string]interface{})
-	rand, err := crand.Int(crand.Reader, big.NewInt(1000000))
-	if err != nil {
-		models.Log("error generating random number:", err.Error())
-	}
 	photo := &models.Photo{
 		Title:       p["title"].(string),
 		Description: p["description"].(string),
@@ -147,7 +145,8 @@ func Upload(w http.ResponseWriter, req *http.Request, ctx *models.Context) error
 		Deleted:     false,
 		User:        ctx.User.Id,
 		UpdatedOn:   time.Now(),
-		Rand:        rand.Int64(),
+		Rand:        models.RandValue(),
+		AltRand:     models.RandValue(),
 	}
 	var objectToBeUpdated interface{}
 	var nid bson.ObjectId
@@ -227,6 +226,10 @@ func Delete(w http.ResponseWriter, req *http.Request, ctx *models.Context) error
 		return perform_status(w, req, http.StatusForbidden)
 	}
 
+	// contests still accepting entries drop the photo, the others keep it
+	if err := models.WithdrawPhoto(ctx, ctx.User.Id, bson.ObjectIdHex(id)); err != nil {
+		models.Log("Error withdrawing photo from contests: ", err.Error())
+	}
 	if rc, _ := ctx.C(C).Find(bson.M{"registered.photo": bson.ObjectIdHex(id)}).Count(); rc != 0 {
 		// the photo is registered in contests
 		// only mark as deleted
@@ -257,6 +260,10 @@ func Delete(w http.ResponseWriter, req *http.Request, ctx *models.Context) error
 		if _, err := ctx.C(V).RemoveAll(bson.M{"photo": bson.ObjectIdHex(id)}); err != nil {
 			models.Log("Error deleting votes on photo delete: ", err.Error())
 		}
+		// delete related comments
+		if _, err := ctx.C(CM).RemoveAll(bson.M{"kind": models.COMMENT_PHOTO, "target": bson.ObjectIdHex(id)}); err != nil {
+			models.Log("Error deleting comments on photo delete: ", err.Error())
+		}
 	}
 
 	http.Redirect(w, req, reverse("upload", "id", ""), http.StatusSeeOther)
@@ -305,62 +312,78 @@ func Empty(w http.ResponseWriter, req *http.Request, ctx *models.Context) error
 	})
 }
 
+// rankedPhotos returns a page of the voted photos matching the query ordered
+// by the named ranker and the total number of ranked photos.
+func rankedPhotos(ctx *models.Context, rank string, query bson.M, skip, limit int) (photos []*models.Photo, max int, err error) {
+	ranker := models.GetRanker(rank)
+	if sr, ok := ranker.(models.ScoreRanker); ok {
+		query["score.count"] = bson.M{"$gt": 0}
+		if max, err = ctx.C(P).Find(query).Count(); err != nil {
+			return
+		}
+		err = ctx.C(P).Find(query).Sort("-" + sr.Field()).Skip(skip).Limit(limit).All(&photos)
+		return
+	}
+	// the votes carry the photo fields used by the query
+	ranked, err := models.RankVotes(ctx, ranker, query)
+	if err != nil {
+		return
+	}
+	max = len(ranked)
+	if skip >= max {
+		return
+	}
+	if skip+limit < max {
+		ranked = ranked[skip : skip+limit]
+	} else {
+		ranked = ranked[skip:]
+	}
+	ids := make([]bson.ObjectId, len(ranked))
+	for i, r := range ranked {
+		ids[i] = r.Photo
+	}
+	var found []*models.Photo
+	if err = ctx.C(P).Find(bson.M{"_id": bson.M{"$in": ids}}).All(&found); err != nil {
+		return
+	}
+	byId := make(map[bson.ObjectId]*models.Photo, len(found))
+	for _, p := range found {
+		byId[p.Id] = p
+	}
+	for _, id := range ids {
+		if p, ok := byId[id]; ok {
+			photos = append(photos, p)
+		}
+	}
+	return
+}
+
 func TopVoted(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	return rankedList(w, req, ctx, req.URL.Query().Get("rank"))
+}
+
+func Trending(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	return rankedList(w, req, ctx, models.RANK_TRENDING)
+}
+
+func rankedList(w http.ResponseWriter, req *http.Request, ctx *models.Context, rank string) error {
 	page := 1
 	page, err := strconv.Atoi(req.URL.Query().Get(":page"))
 	if err != nil && page == 0 {
 		page = 1
 	}
 	skip := ITEMS_PER_PAGE * (page - 1)
-	match := bson.M{"active": true}
-	if f, ok := ctx.Session.Values["filter"]; ok {
-		f.(*models.Filter).AddQuery(match)
-	}
-	var results models.WilsonSorter
-	pipe := ctx.C(V).Pipe([]bson.M{
-		{"$match": match},
-		{"$group": bson.M{
-			"_id":         "$photo",
-			"scores":      bson.M{"$push": "$score"},
-			"title":       bson.M{"$addToSet": "$title"},
-			"description": bson.M{"$addToSet": "$description"},
-			"user":        bson.M{"$addToSet": "$photouser"},
-		}},
-		{"$skip": skip},
-		{"$limit": ITEMS_PER_PAGE},
-		{"$unwind": "$user"},
-		{"$unwind": "$title"},
-		{"$unwind": "$description"},
-	})
-	pipe.All(&results)
-
-	// calculate wilson rating http://www.goproblems.com/test/wilson/wilson-new.php
-	vc := make([]int, 5)
-	for _, r := range results {
-		scores := r["scores"].([]interface{})
-		for _, s := range scores {
-			index := int(s.(float64) - 1)
-			vc[index] += 1
-		}
-		sum := 0.0
-		for i, c := range vc {
-			w := float64(i) / 4.0
-			sum += float64(c) * w
-		}
-		r["wilson"] = models.Wilson(len(scores), sum)
-		vc[0], vc[1], vc[2], vc[3], vc[4] = 0, 0, 0, 0, 0
+	query := bson.M{"active": true}
+	if f := activeFilter(req, ctx); f != nil {
+		f.AddQuery(query)
+	}
+	photos, _, err := rankedPhotos(ctx, rank, query, skip, ITEMS_PER_PAGE)
+	if err != nil {
+		return internal_error(w, req, err.Error())
 	}
-	sort.Sort(results)
-
 	data := ""
 	var layer bytes.Buffer
-	for _, r := range results {
-		p := &models.Photo{
-			Id:          r["_id"].(bson.ObjectId),
-			User:        r["user"].(bson.ObjectId),
-			Title:       r["title"].(string),
-			Description: r["description"].(string),
-		}
+	for _, p := range photos {
 		err := layerTemplate.Execute(&layer, map[string]interface{}{"p": p, "ctx": ctx})
 		if err != nil {
 			models.Log("layer template: ", err.Error())
@@ -389,8 +412,8 @@ func Latest(w http.ResponseWriter, req *http.Request, ctx *models.Context) error
 	}
 	skip := ITEMS_PER_PAGE * (page - 1)
 	query := bson.M{"active": true}
-	if f, ok := ctx.Session.Values["filter"]; ok {
-		f.(*models.Filter).AddQuery(query)
+	if f := activeFilter(req, ctx); f != nil {
+		f.AddQuery(query)
 	}
 	var photos []*models.Photo
 	if err := ctx.C("photos").Find(query).Skip(skip).Limit(ITEMS_PER_PAGE).Sort("-_id").All(&photos); err != nil {
@@ -425,21 +448,25 @@ func Random(w http.ResponseWriter, req *http.Request, ctx *models.Context) error
 	if err != nil && page == 0 {
 		page = 1
 	}
-	skip := ITEMS_PER_PAGE * (page - 1)
 	query := bson.M{"active": true}
-	if f, ok := ctx.Session.Values["filter"]; ok {
-		f.(*models.Filter).AddQuery(query)
+	if f := activeFilter(req, ctx); f != nil {
+		f.AddQuery(query)
 	}
 
-	//execute the query
-	var photos []*models.Photo
-	if err := ctx.C("photos").Find(query).Skip(skip).Limit(ITEMS_PER_PAGE).Sort("-_id").All(&photos); err != nil {
+	// a new seed on the first page, the next pages go on from the last
+	// photo seen
+	cur, ok := ctx.Session.Values["rand_cursor"].(*models.RandCursor)
+	if !ok || page <= 1 {
+		cur = models.NewRandCursor()
+	}
+	photos, err := models.RandomPhotos(ctx, query, cur, ITEMS_PER_PAGE)
+	if err != nil {
 		return internal_error(w, req, err.Error())
 	}
+	ctx.Session.Values["rand_cursor"] = cur
 	data := ""
 	var layer bytes.Buffer
-	for _, i := range rand.Perm(len(photos)) {
-		p := photos[i]
+	for _, p := range photos {
 		err := layerTemplate.Execute(&layer, map[string]interface{}{"p": p, "ctx": ctx})
 		if err != nil {
 			models.Log("layer template: ", err.Error())
@@ -460,6 +487,30 @@ func Random(w http.ResponseWriter, req *http.Request, ctx *models.Context) error
 	return nil
 }
 
+// View counts an impression of the photo, not counting the owner's.
+func View(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	photoId := req.URL.Query().Get(":photo")
+	if !bson.IsObjectIdHex(photoId) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	id := bson.ObjectIdHex(photoId)
+	// the anonymous viewers are told apart by address, a new session
+	// does not count as a new viewer
+	viewer := remoteIP(req)
+	if ctx.User != nil {
+		if n, _ := ctx.C(P).Find(bson.M{"_id": id, "user": ctx.User.Id}).Count(); n > 0 {
+			return nil
+		}
+		viewer = ctx.User.Id.Hex()
+	}
+	models.TrackView(viewer, id)
+	fmt.Fprint(w, "ok")
+	return nil
+}
+
 func Fake(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 	return report(w, req, ctx, "fake")
 }
@@ -508,8 +559,11 @@ func SetAvatar(w http.ResponseWriter, req *http.Request, ctx *models.Context) er
 	if bson.IsObjectIdHex(photoId) {
 		newAvatar := models.ImageUrl(photoId, "thumb")
 		ctx.User.Avatar = newAvatar
-		ctx.C(U).UpdateId(ctx.User.Id, bson.M{"$set": bson.M{"avatar": newAvatar}})
-		//ctx.C(P).Update(bson.M{"comments.user": ctx.User.Id}, bson.M{"comments.$.avatar": bson.M{"$set": ctx.User.Gravatar(80)}})
+		if err := ctx.C(U).UpdateId(ctx.User.Id, bson.M{"$set": bson.M{"avatar": newAvatar}}); err != nil {
+			models.Log("error setting avatar: ", err.Error())
+			return nil
+		}
+		go syncAuthor(ctx.User.Id)
 	}
 	return nil
 }
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"app/models"
+	"encoding/csv"
+	"fmt"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ratingsQuery selects the votes of the user, all of them or only the
+// global or the contest ones.
+func ratingsQuery(ctx *models.Context, scope string) bson.M {
+	query := bson.M{"user": ctx.User.Id}
+	switch scope {
+	case "global":
+		query["contest"] = bson.M{"$exists": false}
+	case "contest":
+		query["contest"] = bson.M{"$exists": true}
+	}
+	return query
+}
+
+// contestNames returns the names of the contests the votes were cast in.
+func contestNames(ctx *models.Context, votes []*models.Vote) map[bson.ObjectId]string {
+	var ids []bson.ObjectId
+	for _, v := range votes {
+		if v.Contest != "" {
+			ids = append(ids, v.Contest)
+		}
+	}
+	names := make(map[bson.ObjectId]string)
+	if len(ids) == 0 {
+		return names
+	}
+	var contests []*models.Contest
+	if err := ctx.C(C).Find(bson.M{"_id": bson.M{"$in": ids}}).Select(bson.M{"name": 1}).All(&contests); err != nil {
+		models.Log("error getting contest names: ", err.Error())
+	}
+	for _, c := range contests {
+		names[c.Id] = c.Name
+	}
+	return names
+}
+
+func Ratings(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	scope := req.URL.Query().Get("scope")
+	query := ratingsQuery(ctx, scope)
+	max, _ := ctx.C(V).Find(query).Count()
+	p := NewPagination(max, req.URL.Query())
+	skip := p.PerPage * (p.Current - 1)
+	var votes []*models.Vote
+	if err := ctx.C(V).Find(query).Sort("-updatedon").Skip(skip).Limit(p.PerPage).All(&votes); err != nil {
+		models.Log("error getting ratings: ", err.Error())
+	}
+	return T("ratings.html").Execute(w, map[string]interface{}{
+		"votes":    votes,
+		"contests": contestNames(ctx, votes),
+		"scope":    scope,
+		"p":        p,
+		"ctx":      ctx,
+	})
+}
+
+func ExportRatings(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	var votes []*models.Vote
+	if err := ctx.C(V).Find(ratingsQuery(ctx, req.URL.Query().Get("scope"))).Sort("-updatedon").All(&votes); err != nil {
+		return internal_error(w, req, err.Error())
+	}
+	names := contestNames(ctx, votes)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=ratings.csv")
+	out := csv.NewWriter(w)
+	out.Write([]string{"photo", "title", "image", "contest", "score", "date"})
+	for _, v := range votes {
+		out.Write([]string{
+			v.Photo.Hex(),
+			csvText(v.Title),
+			models.ImageUrl(v.Photo.Hex(), "thumb"),
+			csvText(names[v.Contest]),
+			fmt.Sprintf("%.0f", v.Score),
+			v.UpdatedOn.Format(time.RFC3339),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// csvText quotes the text written by the users so a spreadsheet does not
+// run it as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// Unvote retracts a vote of the user.
+func Unvote(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	v := &models.Vote{}
+	if err := ctx.C(V).Find(bson.M{"_id": bson.ObjectIdHex(id), "user": ctx.User.Id}).One(v); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	// contest votes are final once the voting is closed
+	if v.Contest != "" {
+		contest := &models.Contest{}
+		if err := ctx.C(C).FindId(v.Contest).One(contest); err == nil && !contest.CanVote() {
+			return perform_status(w, req, http.StatusForbidden)
+		}
+	}
+	if err := ctx.C(V).RemoveId(v.Id); err != nil {
+		models.Log("unvote err: ", err.Error())
+		return nil
+	}
+	if err := models.UnscoreVote(ctx, v); err != nil {
+		models.Log("score err: ", err.Error())
+	}
+	count, _ := ctx.C(V).Find(bson.M{"photo": v.Photo}).Count()
+	models.Publish(models.UserTopic(v.PhotoUser), "vote", map[string]interface{}{
+		"id":    v.Photo.Hex(),
+		"count": count,
+	})
+	fmt.Fprint(w, "ok")
+	return nil
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"app/models"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+)
+
+// MakeRecurring starts a series from the contest, a new contest with the
+// same settings is published at every recurrence.
+func MakeRecurring(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	contest := contestFor(req, ctx, models.PERM_EDIT)
+	if contest == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if _, err := models.NewSeries(ctx, contest, req.FormValue("recurrence")); err != nil {
+		ctx.Session.AddFlash(models.F(models.ERROR, trans("Could not make the contest recurring:", ctx), trans(err.Error(), ctx)))
+	} else {
+		ctx.Session.AddFlash(models.F(models.SUCCESS, trans("The contest is now recurring!", ctx)))
+	}
+	http.Redirect(w, req, reverse("contest", "id", ""), http.StatusSeeOther)
+	return nil
+}
+
+func StopSeries(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if err := models.StopSeries(ctx, bson.ObjectIdHex(id), ctx.User.Id); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	ctx.Session.AddFlash(models.F(models.SUCCESS, trans("No more contests will be created in the series.", ctx)))
+	http.Redirect(w, req, reverse("series", "id", id), http.StatusSeeOther)
+	return nil
+}
+
+// SeriesTemplate replaces the template of the series with a draft of the
+// owner.
+func SeriesTemplate(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	id, draftId := req.URL.Query().Get(":id"), req.FormValue("contest")
+	if !bson.IsObjectIdHex(id) || !bson.IsObjectIdHex(draftId) {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	draft := &models.Contest{}
+	if err := ctx.C(C).Find(bson.M{"_id": bson.ObjectIdHex(draftId), "user": ctx.User.Id, "public": false}).One(draft); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if err := models.SetTemplate(ctx, bson.ObjectIdHex(id), ctx.User.Id, draft); err != nil {
+		ctx.Session.AddFlash(models.F(models.ERROR, trans("Could not change the template:", ctx), trans(err.Error(), ctx)))
+	} else {
+		ctx.Session.AddFlash(models.F(models.SUCCESS, trans("The next contests will use the new settings.", ctx)))
+	}
+	http.Redirect(w, req, reverse("series", "id", id), http.StatusSeeOther)
+	return nil
+}
+
+// SeriesPage lists the contests of the series with their winners.
+func SeriesPage(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	series := &models.Series{}
+	if err := ctx.C(S).FindId(bson.ObjectIdHex(id)).One(series); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	all, err := models.SeriesContests(ctx, series.Id)
+	if err != nil {
+		return internal_error(w, req, err.Error())
+	}
+	var contests []*models.Contest
+	for _, c := range all {
+		if c.Admits(ctx.User) {
+			contests = append(contests, c)
+		}
+	}
+	if len(contests) == 0 {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	owner := ctx.User != nil && ctx.User.Id == series.User
+	var drafts []*models.Contest
+	if owner {
+		ctx.C(C).Find(bson.M{"user": ctx.User.Id, "public": false}).Select(bson.M{"name": 1}).All(&drafts)
+	}
+	return T("series.html").Execute(w, map[string]interface{}{
+		"series":   series,
+		"contests": contests,
+		"owner":    owner,
+		"drafts":   drafts,
+		"ctx":      ctx,
+	})
+}
@@ -16,14 +16,16 @@ var (
 	cachedMutex     sync.Mutex
 
 	funcs = template.FuncMap{
-		"reverse":    reverse,
-		"eq":         eq,
-		"neq":        neq,
-		"to_p":       to_p,
-		"image":      models.ImageUrl,
-		"human_time": humanize.Time,
-		"trunc":      truncateString,
-		"trans":      trans,
+		"reverse":     reverse,
+		"eq":          eq,
+		"neq":         neq,
+		"to_p":        to_p,
+		"image":       models.ImageUrl,
+		"human_time":  humanize.Time,
+		"trunc":       truncateString,
+		"trans":       trans,
+		"can_message": canMessage,
+		"local_time":  models.LocalTime,
 	}
 )
 
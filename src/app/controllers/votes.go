@@ -3,9 +3,10 @@ package controllers
 import (
 	"app/models"
 	"fmt"
+	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
+	"net"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -30,23 +31,21 @@ func Vote(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 	if c, _ := ctx.C(P).Find(bson.M{"_id": bson.ObjectIdHex(photoId), "user": ctx.User.Id}).Limit(1).Count(); c != 0 {
 		return perform_status(w, req, http.StatusForbidden)
 	}
+	if models.IsBlocked(ctx, photo.User, ctx.User.Id) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
 
 	contestId := req.URL.Query().Get(":contest")
 	var contest bson.ObjectId
 	if contestId != "" && bson.IsObjectIdHex(contestId) {
 		contest = bson.ObjectIdHex(contestId)
-		// check contest is in voting period
-		now := time.Now()
-		query := ctx.C(C).Find(bson.M{
-			"_id":               contest,
-			"admissiondeadline": bson.M{"$lt": now},
-			"votingdeadline":    bson.M{"$gt": now},
-		}).Limit(1)
-		if count, err := query.Count(); count != 1 || err != nil {
+		// check contest is in voting period and open to the public
+		c := &models.Contest{}
+		if err := ctx.C(C).Find(bson.M{"_id": contest, "state": models.STATE_VOTING}).One(c); err != nil || !c.PublicVoting() || !c.Admits(ctx.User) {
 			return perform_status(w, req, http.StatusForbidden)
 		}
 	}
-	hearts, err := strconv.ParseFloat(req.FormValue("v"), 64)
+	hearts, err := strconv.Atoi(req.FormValue("v"))
 	if err != nil || hearts < 1 || hearts > 5 {
 		return perform_status(w, req, http.StatusForbidden)
 	}
@@ -61,9 +60,12 @@ func Vote(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 		Gender:      photo.Gender,
 		Active:      photo.Active,
 		Contest:     contest,
-		Score:       hearts,
+		Score:       float64(hearts),
 		UpdatedOn:   time.Now(),
 		User:        ctx.User.Id,
+		IP:          remoteIP(req),
+		Distrust:    ctx.User.Distrust,
+		Voter:       models.VoterDemographics(ctx.User),
 	}
 	query := bson.M{"photo": v.Photo, "user": v.User}
 	if contestId != "" {
@@ -71,12 +73,53 @@ func Vote(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 	} else {
 		query["contest"] = bson.M{"$exists": false}
 	}
-	if _, err := ctx.C(V).Upsert(query, v); err != nil {
+	// the replaced vote comes back with the same write, zero score for a
+	// new one; a concurrent insert of the same vote is retried as a change
+	old := &models.Vote{}
+	change := mgo.Change{Update: v, Upsert: true}
+	_, err = ctx.C(V).Find(query).Apply(change, old)
+	if mgo.IsDup(err) {
+		_, err = ctx.C(V).Find(query).Apply(change, old)
+	}
+	if err != nil {
 		models.Log("vote err: ", err.Error())
+		return nil
+	}
+	if err := models.ScoreVote(ctx, old, v); err != nil {
+		models.Log("score err: ", err.Error())
 	}
+	// the vote count is private to the owner like in GetPhotoVotes
+	count, _ := ctx.C(V).Find(bson.M{"photo": v.Photo}).Count()
+	models.Publish(models.UserTopic(v.PhotoUser), "vote", map[string]interface{}{
+		"id":    photoId,
+		"count": count,
+	})
+	fmt.Fprint(w, "ok")
 	return nil
 }
 
+// TrustedProxies is the number of proxies in front of the server appending
+// to the X-Forwarded-For header, the header is ignored without any.
+var TrustedProxies = 1
+
+// remoteIP returns the address of the client as seen by the outermost
+// trusted proxy, the entries before it are sent by the client.
+func remoteIP(req *http.Request) string {
+	if fwd := req.Header.Get("X-Forwarded-For"); fwd != "" && TrustedProxies > 0 {
+		hops := strings.Split(fwd, ",")
+		i := len(hops) - TrustedProxies
+		if i < 0 {
+			i = 0
+		}
+		return strings.TrimSpace(hops[i])
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
 func GetVote(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 	if ctx.User == nil {
 		return perform_status(w, req, http.StatusForbidden)
@@ -114,75 +157,191 @@ func GetVote(w http.ResponseWriter, req *http.Request, ctx *models.Context) erro
 	})
 }
 
+// activeFilter returns the filter of the request, the one in the url
+// parameters when present, otherwise the one in the session.
+func activeFilter(req *http.Request, ctx *models.Context) *models.Filter {
+	if v := req.URL.Query(); models.HasFilter(v) {
+		if f, err := models.ParseFilter(v); err == nil {
+			f.Name = ""
+			ctx.Session.Values["filter"] = f
+			return f
+		}
+	}
+	if f, ok := ctx.Session.Values["filter"].(*models.Filter); ok {
+		return f
+	}
+	return nil
+}
+
+// filterRedirect goes to the index with the filter in the url.
+func filterRedirect(w http.ResponseWriter, req *http.Request, f *models.Filter) {
+	url := reverse("index")
+	if q := f.Query(); q != "" {
+		url += "?" + q
+	}
+	http.Redirect(w, req, url, http.StatusSeeOther)
+}
+
 func Filter(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
 	if req.FormValue("csrf_token") != ctx.Session.Values["csrf_token"] {
 		return perform_status(w, req, http.StatusForbidden)
 	}
-	f := &models.Filter{
-		Country:  strings.TrimSpace(req.FormValue("country")),
-		Location: req.FormValue("location"),
-		Gender:   strings.TrimSpace(req.FormValue("gender")),
-	}
-	err := f.ParseAge(req.FormValue("age"))
+	req.ParseForm()
+	f, err := models.ParseFilter(req.Form)
 	if err != nil {
 		ctx.Session.AddFlash(models.F(models.ERROR, trans("Invalid age range", ctx)))
 		http.Redirect(w, req, reverse("index"), http.StatusSeeOther)
 		return nil
 	}
+	if f.Name != "" && ctx.User != nil {
+		if err := models.SaveFilter(ctx, f); err != nil {
+			models.Log("error saving filter: ", err.Error())
+			ctx.Session.AddFlash(models.F(models.ERROR, trans("Could not save the filter", ctx)))
+		} else {
+			ctx.Session.AddFlash(models.F(models.SUCCESS, trans("Filter saved", ctx)))
+		}
+	}
+	f.Name = ""
 	ctx.Session.Values["filter"] = f
+	filterRedirect(w, req, f)
+	return nil
+}
+
+// UseFilter activates a filter saved by the user.
+func UseFilter(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
+	saved := ctx.User.SavedFilter(req.URL.Query().Get("name"))
+	if saved == nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	f := *saved
+	f.Name = ""
+	ctx.Session.Values["filter"] = &f
+	filterRedirect(w, req, &f)
+	return nil
+}
+
+// DelFilter removes a filter saved by the user.
+func DelFilter(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if req.URL.Query().Get(":csrf_token") != ctx.Session.Values["csrf_token"] {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	if err := models.DeleteFilter(ctx, req.URL.Query().Get("name")); err != nil {
+		models.Log("error deleting filter: ", err.Error())
+	}
 	http.Redirect(w, req, reverse("index"), http.StatusSeeOther)
 	return nil
 }
 
 func Rankings(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
-	var results models.WilsonSorter
-	pipe := ctx.C(V).Pipe([]bson.M{
-		{"$match": bson.M{"active": true}},
-		{"$group": bson.M{
-			"_id":         "$photo",
-			"count":       bson.M{"$sum": 1},
-			"avg":         bson.M{"$avg": "$score"},
-			"scores":      bson.M{"$push": "$score"},
-			"title":       bson.M{"$addToSet": "$title"},
-			"description": bson.M{"$addToSet": "$description"},
-			"user":        bson.M{"$addToSet": "$photouser"},
-		}},
-		{"$unwind": "$user"},
-		{"$unwind": "$title"},
-		{"$unwind": "$description"},
-	})
-	pipe.All(&results)
-	// calculate wilson rating http://www.goproblems.com/test/wilson/wilson-new.php
-	vc := make([]int, 5)
-	for _, r := range results {
-		scores := r["scores"].([]interface{})
-		for _, s := range scores {
-			index := int(s.(float64) - 1)
-			vc[index] += 1
-		}
-		sum := 0.0
-		for i, c := range vc {
-			w := float64(i) / 4.0
-			sum += float64(c) * w
-		}
-		r["wilson"] = models.Wilson(len(scores), sum)
-		vc[0], vc[1], vc[2], vc[3], vc[4] = 0, 0, 0, 0, 0
+	rank := req.URL.Query().Get("rank")
+	if _, ok := models.Rankers[rank]; !ok {
+		rank = models.RANK_WILSON
+	}
+	query := bson.M{"active": true}
+	if f := activeFilter(req, ctx); f != nil {
+		f.AddQuery(query)
+	}
+	p := NewPagination(0, req.URL.Query())
+	skip := p.PerPage * (p.Current - 1)
+	photos, max, err := rankedPhotos(ctx, rank, query, skip, p.PerPage)
+	if err != nil {
+		return internal_error(w, req, err.Error())
 	}
-	sort.Sort(results)
+	p.Max = max
 	return AJAX("rankings.html").Execute(w, map[string]interface{}{
-		"results": results,
-		"ctx":     ctx,
+		"photos": photos,
+		"rank":   rank,
+		"p":      p,
+		"ctx":    ctx,
 	})
 }
 
-func GetPhotoVotes(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+func RankingsBy(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	by := req.URL.Query().Get(":by")
+	query := bson.M{"active": true, "score.count": bson.M{"$gt": 0}}
+	if f := activeFilter(req, ctx); f != nil {
+		f.AddQuery(query)
+	}
+	groups, err := models.TopPhotosBy(ctx, by, query, RANKINGS_PER_GROUP)
+	if err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	return AJAX("rankings_by.html").Execute(w, map[string]interface{}{
+		"by":     by,
+		"groups": groups,
+		"ctx":    ctx,
+	})
+}
+
+// PhotoBreakdown shows the owner how the voters of each demographic rated the photo.
+func PhotoBreakdown(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	photo := &models.Photo{}
+	if err := ctx.C(P).Find(bson.M{"_id": bson.ObjectIdHex(id), "user": ctx.User.Id}).Select(bson.M{"user": 1}).One(photo); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	breakdown, err := models.PhotoRatingBreakdown(ctx, photo.Id)
+	if err != nil {
+		return internal_error(w, req, err.Error())
+	}
+	return AJAX("breakdown.html").Execute(w, map[string]interface{}{
+		"b":   breakdown,
+		"ctx": ctx,
+	})
+}
+
+func PhotoAnalytics(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	if ctx.User == nil {
+		http.Redirect(w, req, reverse("login"), http.StatusSeeOther)
+		return nil
+	}
 	id := req.URL.Query().Get(":id")
 	if !bson.IsObjectIdHex(id) {
 		return perform_status(w, req, http.StatusForbidden)
 	}
-	match := bson.M{"photo": bson.ObjectIdHex(id)}
-	if f, ok := ctx.Session.Values["filter"]; ok {
-		f.(*models.Filter).AddQuery(match)
+	photo := &models.Photo{}
+	if err := ctx.C(P).Find(bson.M{"_id": bson.ObjectIdHex(id), "user": ctx.User.Id, "deleted": false}).One(photo); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	a, err := models.PhotoAnalytics(ctx, photo)
+	if err != nil {
+		return internal_error(w, req, err.Error())
+	}
+	return T("analytics.html").Execute(w, map[string]interface{}{
+		"a":   a,
+		"ctx": ctx,
+	})
+}
+
+func GetPhotoVotes(w http.ResponseWriter, req *http.Request, ctx *models.Context) error {
+	id := req.URL.Query().Get(":id")
+	if !bson.IsObjectIdHex(id) || ctx.User == nil {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	// the votes and views are private to the owner
+	p := &models.Photo{}
+	if err := ctx.C(P).FindId(bson.ObjectIdHex(id)).Select(bson.M{"user": 1, "score.views": 1}).One(p); err != nil {
+		return perform_status(w, req, http.StatusNotFound)
+	}
+	if p.User != ctx.User.Id {
+		return perform_status(w, req, http.StatusForbidden)
+	}
+	match := bson.M{"photo": p.Id}
+	if f := activeFilter(req, ctx); f != nil {
+		f.AddQuery(match)
 	}
 	var result bson.M
 	pipe := ctx.C(V).Pipe([]bson.M{
@@ -191,15 +350,10 @@ func GetPhotoVotes(w http.ResponseWriter, req *http.Request, ctx *models.Context
 			"_id":   "$photo",
 			"avg":   bson.M{"$avg": "$score"},
 			"count": bson.M{"$sum": 1},
-			"user":  bson.M{"$addToSet": "$photouser"},
 		}},
-		{"$unwind": "$user"},
 	})
 	pipe.One(&result)
-	if result["user"] != nil && result["user"].(bson.ObjectId) != ctx.User.Id {
-		return perform_status(w, req, http.StatusForbidden)
-	}
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"avg": %.1f, "count": %d}`, result["avg"], result["count"])
+	fmt.Fprintf(w, `{"avg": %.1f, "count": %d, "views": %d}`, result["avg"], result["count"], p.Score.Views)
 	return nil
 }
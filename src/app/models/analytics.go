@@ -0,0 +1,154 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+const ANALYTICS_DAYS = 90
+
+type DayVotes struct {
+	Day   time.Time
+	Count int
+	Sum   float64
+}
+
+func (d *DayVotes) Avg() float64 {
+	if d.Count == 0 {
+		return 0
+	}
+	return d.Sum / float64(d.Count)
+}
+
+// Analytics gathers the statistics shown to the owner of a photo.
+type Analytics struct {
+	Photo  *Photo
+	Hist   []int // number of votes for each heart count
+	Days   []*DayVotes
+	Others []*Photo // all the photos of the owner ordered by rank
+}
+
+type HistBar struct {
+	Hearts, Count, Percent int
+}
+
+// Bars returns the histogram with the share of the votes for each heart count.
+func (a *Analytics) Bars() []HistBar {
+	total := 0
+	for _, c := range a.Hist {
+		total += c
+	}
+	bars := make([]HistBar, len(a.Hist))
+	for i, c := range a.Hist {
+		bars[i] = HistBar{Hearts: i + 1, Count: c}
+		if total > 0 {
+			bars[i].Percent = c * 100 / total
+		}
+	}
+	return bars
+}
+
+// DayPercent returns the votes of the day relative to the busiest day.
+func (a *Analytics) DayPercent(d *DayVotes) int {
+	max := 0
+	for _, x := range a.Days {
+		if x.Count > max {
+			max = x.Count
+		}
+	}
+	if max == 0 {
+		return 0
+	}
+	return d.Count * 100 / max
+}
+
+// Position returns the place of the photo among the photos of the owner.
+func (a *Analytics) Position() int {
+	for i, p := range a.Others {
+		if p.Id == a.Photo.Id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// OwnerAvg is the average vote received by the photos of the owner.
+func (a *Analytics) OwnerAvg() float64 {
+	sum, total := 0.0, 0.0
+	for _, p := range a.Others {
+		sum += p.Score.Sum
+		total += p.Score.Total()
+	}
+	if total <= 0 {
+		return 0
+	}
+	return sum / total
+}
+
+func PhotoAnalytics(ctx *Context, photo *Photo) (a *Analytics, err error) {
+	a = &Analytics{Photo: photo, Hist: make([]int, 5)}
+	var hist []struct {
+		Score float64 `bson:"_id"`
+		Count int
+	}
+	if err = ctx.C("votes").Pipe([]bson.M{
+		{"$match": bson.M{"photo": photo.Id}},
+		{"$group": bson.M{"_id": "$score", "count": bson.M{"$sum": 1}}},
+	}).All(&hist); err != nil {
+		return
+	}
+	for _, h := range hist {
+		if h.Score >= 1 && h.Score <= 5 {
+			a.Hist[int(h.Score)-1] = h.Count
+		}
+	}
+
+	var days []struct {
+		Day   struct{ Year, Month, Day int } `bson:"_id"`
+		Count int
+		Sum   float64
+	}
+	if err = ctx.C("votes").Pipe([]bson.M{
+		{"$match": bson.M{"photo": photo.Id, "updatedon": bson.M{"$gt": time.Now().AddDate(0, 0, -ANALYTICS_DAYS)}}},
+		{"$group": bson.M{
+			"_id":   bson.M{"year": bson.M{"$year": "$updatedon"}, "month": bson.M{"$month": "$updatedon"}, "day": bson.M{"$dayOfMonth": "$updatedon"}},
+			"count": bson.M{"$sum": 1},
+			"sum":   bson.M{"$sum": "$score"},
+		}},
+		{"$sort": bson.M{"_id.year": 1, "_id.month": 1, "_id.day": 1}},
+	}).All(&days); err != nil {
+		return
+	}
+	for _, d := range days {
+		a.Days = append(a.Days, &DayVotes{
+			Day:   time.Date(d.Day.Year, time.Month(d.Day.Month), d.Day.Day, 0, 0, 0, 0, time.UTC),
+			Count: d.Count,
+			Sum:   d.Sum,
+		})
+	}
+
+	err = ctx.C("photos").Find(bson.M{"user": photo.User, "deleted": false}).
+		Select(bson.M{"title": 1, "score": 1}).Sort("-score.wilson").All(&a.Others)
+	return
+}
+
+// CopyVoterDemographics fills the voter demographics on the votes cast
+// before they were recorded.
+func CopyVoterDemographics() error {
+	db := db_session.Clone().DB(database)
+	defer db.Session.Close()
+	var voters []bson.ObjectId
+	if err := db.C("votes").Find(bson.M{"voter": bson.M{"$exists": false}}).Distinct("user", &voters); err != nil {
+		return err
+	}
+	var u User
+	iter := db.C("users").Find(bson.M{"_id": bson.M{"$in": voters}}).Select(bson.M{"country": 1, "location": 1, "gender": 1, "birthdate": 1}).Iter()
+	for iter.Next(&u) {
+		query := bson.M{"user": u.Id, "voter": bson.M{"$exists": false}}
+		if _, err := db.C("votes").UpdateAll(query, bson.M{"$set": bson.M{"voter": VoterDemographics(&u)}}); err != nil {
+			return err
+		}
+		u = User{}
+	}
+	return iter.Close()
+}
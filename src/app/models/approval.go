@@ -0,0 +1,107 @@
+package models
+
+import (
+	"fmt"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// REASON_NOT_APPROVED is given to the entries still pending when the
+// voting starts.
+const REASON_NOT_APPROVED = "The entry was not approved before the voting"
+
+// Rejections returns the rejected entries of the user.
+func (c *Contest) Rejections(user bson.ObjectId) (rejected []*RegItem) {
+	for _, ri := range c.Registered {
+		if ri.User == user && ri.Rejected {
+			rejected = append(rejected, ri)
+		}
+	}
+	return
+}
+
+// Rejected tells if the photo was rejected from the contest.
+func (c *Contest) Rejected(photo bson.ObjectId) bool {
+	for _, ri := range c.Registered {
+		if ri.Photo == photo && ri.Rejected {
+			return true
+		}
+	}
+	return false
+}
+
+// Competing returns the entries that were not rejected.
+func (c *Contest) Competing() (entries []*RegItem) {
+	for _, ri := range c.Registered {
+		if !ri.Rejected {
+			entries = append(entries, ri)
+		}
+	}
+	return
+}
+
+// activeEntry matches the entry of the photo unless it was rejected.
+func activeEntry(photo bson.ObjectId) bson.M {
+	return bson.M{"$elemMatch": bson.M{"photo": photo, "rejected": bson.M{"$ne": true}}}
+}
+
+// ApproveEntries approves the photos in the contest, returning how many
+// were approved.
+func ApproveEntries(ctx *Context, c *Contest, photos []bson.ObjectId, reviewer bson.ObjectId) (n int) {
+	for _, p := range photos {
+		err := ctx.C("contests").Update(bson.M{"_id": c.Id, "registered": activeEntry(p)}, bson.M{"$set": bson.M{
+			"registered.$.approved":   true,
+			"registered.$.reviewedby": reviewer,
+			"registered.$.reviewedon": time.Now(),
+		}})
+		if err != nil {
+			Log("error approving entry: ", err.Error())
+			continue
+		}
+		n++
+	}
+	return
+}
+
+// RejectEntries marks the photos as rejected and tells the entrants why.
+// The rejected entries stay in the contest so the decision can be audited,
+// the entrants can enter another photo.
+func RejectEntries(ctx *Context, c *Contest, photos []bson.ObjectId, reason string, reviewer bson.ObjectId) (n int) {
+	set := bson.M{
+		"registered.$.approved":   false,
+		"registered.$.rejected":   true,
+		"registered.$.reason":     reason,
+		"registered.$.reviewedon": time.Now(),
+	}
+	if reviewer != "" {
+		set["registered.$.reviewedby"] = reviewer
+	}
+	for _, p := range photos {
+		ri := c.PhotoEntry(p)
+		if ri == nil || ri.Rejected {
+			continue
+		}
+		update := bson.M{"$set": set, "$inc": CountEntries(ri.User, -1)}
+		if err := ctx.C("contests").Update(bson.M{"_id": c.Id, "registered": activeEntry(p)}, update); err != nil {
+			Log("error rejecting entry: ", err.Error())
+			continue
+		}
+		notifyRejection(ctx, c, ri, reason)
+		n++
+	}
+	return
+}
+
+func notifyRejection(ctx *Context, c *Contest, ri *RegItem, reason string) {
+	body := fmt.Sprintf("Your photo %s was not accepted in the contest %s.", ri.Title, c.Name)
+	if reason != "" {
+		body += " " + reason + "."
+	}
+	if c.CanRegister() {
+		body += " You can enter a different photo."
+	}
+	if err := notifyContest(ctx, c, ri.User, "entry rejected", body); err != nil {
+		Log("error notifying rejection: ", err.Error())
+	}
+	Publish(UserTopic(ri.User), "contest_rejected", map[string]string{"id": c.Id.Hex(), "name": c.Name})
+}
@@ -2,19 +2,178 @@ package models
 
 import (
 	"github.com/rif/forms"
+	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+const (
+	COMMENT_EDIT_WINDOW = 15 * time.Minute
+	COMMENT_PHOTO       = "p"
+	COMMENT_CONTEST     = "c"
 )
 
 type Comment struct {
-	Id       bson.ObjectId `bson:"_id,omitempty"`
-	User     bson.ObjectId
-	UserName string
-	Avatar   string
-	Body     string
+	Id        bson.ObjectId `bson:"_id,omitempty"`
+	Kind      string
+	Target    bson.ObjectId
+	User      bson.ObjectId
+	UserName  string
+	Avatar    string
+	Body      string
+	CreatedOn time.Time
+	EditedOn  time.Time       `bson:"editedon,omitempty"`
+	ReplyTo   bson.ObjectId   `bson:"replyto,omitempty"`
+	Reporters []bson.ObjectId `bson:"reporters,omitempty"`
+	Replies   []*Comment      `bson:"-"`
 }
 
 type Commenter interface {
-	CommentList() []*Comment
+	Owner() bson.ObjectId
+}
+
+// Moderated is implemented by the commented objects that let other users
+// than the owner delete the comments.
+type Moderated interface {
+	Moderator(user bson.ObjectId) bool
+}
+
+// Created falls back to the id timestamp for comments saved before CreatedOn.
+func (c *Comment) Created() time.Time {
+	if c.CreatedOn.IsZero() {
+		return c.Id.Time()
+	}
+	return c.CreatedOn
+}
+
+func (c *Comment) Edited() bool {
+	return !c.EditedOn.IsZero()
+}
+
+// CanEdit reports if the user is the author and the grace window is still open.
+func (c *Comment) CanEdit(u *User) bool {
+	return u != nil && c.User == u.Id && time.Since(c.Created()) < COMMENT_EDIT_WINDOW
+}
+
+// CanDelete allows the author (within the grace window), the owner
+// or the moderators of the commented object and the admins to remove the
+// comment.
+func (c *Comment) CanDelete(u *User, object Commenter) bool {
+	if u == nil {
+		return false
+	}
+	if m, ok := object.(Moderated); ok && m.Moderator(u.Id) {
+		return true
+	}
+	return c.CanEdit(u) || object.Owner() == u.Id || u.Admin
+}
+
+func commentParent(kind string) string {
+	if kind == COMMENT_CONTEST {
+		return "contests"
+	}
+	return "photos"
+}
+
+func threadQuery(kind string, target bson.ObjectId) bson.M {
+	return bson.M{"kind": kind, "target": target, "replyto": bson.M{"$exists": false}}
+}
+
+func CountThreads(ctx *Context, kind string, target bson.ObjectId) (int, error) {
+	return ctx.C("comments").Find(threadQuery(kind, target)).Count()
+}
+
+// LoadThreads returns a page of top level comments with their replies attached.
+func LoadThreads(ctx *Context, kind string, target bson.ObjectId, skip, limit int) (threads []*Comment, err error) {
+	if err = ctx.C("comments").Find(threadQuery(kind, target)).Sort("_id").Skip(skip).Limit(limit).All(&threads); err != nil {
+		return
+	}
+	if len(threads) == 0 {
+		return
+	}
+	byId := make(map[bson.ObjectId]*Comment)
+	ids := make([]bson.ObjectId, len(threads))
+	for i, c := range threads {
+		byId[c.Id] = c
+		ids[i] = c.Id
+	}
+	var replies []*Comment
+	if err = ctx.C("comments").Find(bson.M{"replyto": bson.M{"$in": ids}}).Sort("_id").All(&replies); err != nil {
+		return
+	}
+	for _, r := range replies {
+		if parent, ok := byId[r.ReplyTo]; ok {
+			parent.Replies = append(parent.Replies, r)
+		}
+	}
+	return
+}
+
+// AddComment stores the comment and updates the denormalized count on the parent.
+func AddComment(ctx *Context, c *Comment) error {
+	if err := ctx.C("comments").Insert(c); err != nil {
+		return err
+	}
+	return ctx.C(commentParent(c.Kind)).UpdateId(c.Target, bson.M{"$inc": bson.M{"commentcount": 1}})
+}
+
+// RemoveComment deletes the comment together with its replies.
+func RemoveComment(ctx *Context, c *Comment) error {
+	info, err := ctx.C("comments").RemoveAll(bson.M{"$or": []bson.M{{"_id": c.Id}, {"replyto": c.Id}}})
+	if err != nil {
+		return err
+	}
+	return ctx.C(commentParent(c.Kind)).UpdateId(c.Target, bson.M{"$inc": bson.M{"commentcount": -info.Removed}})
+}
+
+func ensureCommentIndexes(db *mgo.Database) {
+	col := db.C("comments")
+	for _, key := range [][]string{{"kind", "target", "_id"}, {"replyto"}, {"user"}, {"reporters"}} {
+		if err := col.EnsureIndexKey(key...); err != nil {
+			Log("comment index: ", err.Error())
+		}
+	}
+}
+
+// MigrateComments moves the comments embedded in the photos and contests
+// documents into the comments collection, keeping the original ids so the
+// authorship and the creation time are preserved.
+func MigrateComments() error {
+	db := db_session.Clone().DB(database)
+	defer db.Session.Close()
+	for kind, col := range map[string]string{COMMENT_PHOTO: "photos", COMMENT_CONTEST: "contests"} {
+		var doc struct {
+			Id       bson.ObjectId `bson:"_id"`
+			Comments []*Comment
+		}
+		iter := db.C(col).Find(bson.M{"comments": bson.M{"$exists": true}}).Select(bson.M{"comments": 1}).Iter()
+		for iter.Next(&doc) {
+			for _, c := range doc.Comments {
+				c.Kind, c.Target = kind, doc.Id
+				if c.CreatedOn.IsZero() {
+					c.CreatedOn = c.Id.Time()
+				}
+				if _, err := db.C("comments").UpsertId(c.Id, c); err != nil {
+					return err
+				}
+			}
+			count, err := db.C("comments").Find(bson.M{"kind": kind, "target": doc.Id}).Count()
+			if err != nil {
+				return err
+			}
+			if err := db.C(col).UpdateId(doc.Id, bson.M{
+				"$set":   bson.M{"commentcount": count},
+				"$unset": bson.M{"comments": 1},
+			}); err != nil {
+				return err
+			}
+			doc.Comments = nil
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 var (
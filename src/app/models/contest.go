@@ -19,8 +19,25 @@ type Contest struct {
 	VotingDeadline    time.Time
 	Public            bool
 	RequireApproval   bool
+	MaxEntries        int `bson:"maxentries,omitempty"`     // photos a user can enter
+	MinAccountDays    int `bson:"minaccountdays,omitempty"` // account age required to enter
 	Registered        []*RegItem
-	Comments          []*Comment `bson:"comments,omitempty"`
+	CommentCount      int           `bson:"commentcount,omitempty"`
+	Ranking           string        `bson:"ranking,omitempty"`
+	Judging           string        `bson:"judging,omitempty"`    // public, jury or mixed
+	JuryWeight        int           `bson:"juryweight,omitempty"` // percent of the jury in mixed judging
+	Criteria          []string      `bson:"criteria,omitempty"`
+	Jurors            []*Member     `bson:"jurors,omitempty"`
+	Organizers        []*Member     `bson:"organizers,omitempty"`
+	Visibility        string        `bson:"visibility,omitempty"` // public, unlisted or invite
+	InviteCode        string        `bson:"invitecode,omitempty"`
+	Invited           []*Member     `bson:"invited,omitempty"`
+	Series            bson.ObjectId `bson:"series,omitempty"`
+	SeriesNumber      int           `bson:"seriesnumber,omitempty"`
+	Results           []*Result     `bson:"results,omitempty"`
+	ClosedOn          time.Time     `bson:"closedon,omitempty"`
+	State             string        `bson:"state,omitempty"`
+	NextTransition    time.Time     `bson:"nexttransition,omitempty"`
 	User              bson.ObjectId
 }
 
@@ -32,6 +49,10 @@ type RegItem struct {
 	Title       string
 	Description string
 	Approved    bool
+	Rejected    bool          `bson:"rejected,omitempty"` // kept for auditing
+	Reason      string        `bson:"reason,omitempty"`
+	ReviewedBy  bson.ObjectId `bson:"reviewedby,omitempty"`
+	ReviewedOn  time.Time     `bson:"reviewedon,omitempty"`
 }
 
 func (ri *RegItem) Id() bson.ObjectId {
@@ -46,34 +67,51 @@ func (c *Contest) Sex() string {
 }
 
 func (c *Contest) CanRegister() bool {
-	now := time.Now()
-	return now.Before(c.AdmissionDeadline)
+	return c.State == STATE_ADMISSION
 }
 
 func (c *Contest) CanVote() bool {
-	now := time.Now()
-	return now.After(c.AdmissionDeadline) && now.Before(c.VotingDeadline)
-}
-
-func (c *Contest) AD() string {
-	return c.AdmissionDeadline.Format("02 Jan 2006")
-}
-
-func (c *Contest) VD() string {
-	return c.VotingDeadline.Format("02 Jan 2006")
+	return c.State == STATE_VOTING
 }
 
 func (c *Contest) ToBeApproved() (res []*RegItem) {
 	for _, ri := range c.Registered {
-		if !ri.Approved {
+		if !ri.Approved && !ri.Rejected {
 			res = append(res, ri)
 		}
 	}
 	return
 }
 
-func (c *Contest) CommentList() []*Comment {
-	return c.Comments
+func (c *Contest) Owner() bson.ObjectId {
+	return c.User
+}
+
+// Standings ranks the contest photos by the contest votes, the jury
+// scores or both weighted by the judging mode.
+func (c *Contest) Standings(ctx *Context) ([]*Ranked, error) {
+	var jury, public []*Ranked
+	var err error
+	if c.HasJury() {
+		if jury, err = JuryRanking(ctx, c.Id); err != nil {
+			return nil, err
+		}
+	}
+	if !c.PublicVoting() {
+		return jury, nil
+	}
+	switch {
+	case c.Ranking == RANK_ELO:
+		public, _, err = EloRanking(ctx, c.Id, 0, 0)
+	case ContestRanking(c.Ranking):
+		public, err = RankVotes(ctx, GetRanker(c.Ranking), bson.M{"contest": c.Id})
+	default: // the older trending contests
+		public, err = RankVotes(ctx, GetRanker(RANK_WILSON), bson.M{"contest": c.Id})
+	}
+	if err != nil || !c.HasJury() {
+		return public, err
+	}
+	return CombineRankings(jury, public, c.juryShare()), nil
 }
 
 var (
@@ -86,9 +124,18 @@ var (
 			forms.Field{Name: "gender"},
 			forms.Field{Name: "min_age", Converter: forms.IntConverter, Validators: []forms.Validator{forms.NonemptyValidator}},
 			forms.Field{Name: "max_age", Converter: forms.IntConverter, Validators: []forms.Validator{forms.NonemptyValidator}},
-			forms.Field{Name: "admission_deadline", Converter: forms.TimeConverter},
-			forms.Field{Name: "voting_deadline", Converter: forms.TimeConverter},
+			forms.Field{Name: "admission_deadline", Validators: []forms.Validator{forms.NonemptyValidator}},
+			forms.Field{Name: "admission_time"},
+			forms.Field{Name: "voting_deadline", Validators: []forms.Validator{forms.NonemptyValidator}},
+			forms.Field{Name: "voting_time"},
 			forms.Field{Name: "require_approval", Converter: forms.BoolConverter},
+			forms.Field{Name: "ranking"},
+			forms.Field{Name: "max_entries"},
+			forms.Field{Name: "min_account_days"},
+			forms.Field{Name: "judging"},
+			forms.Field{Name: "jury_weight"},
+			forms.Field{Name: "criteria"},
+			forms.Field{Name: "visibility"},
 		},
 	}
 )
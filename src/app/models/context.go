@@ -48,6 +48,7 @@ func init() {
 	gob.Register(bson.ObjectId(""))
 	gob.RegisterName("app/models.Flash", &Flash{"", ""})
 	gob.RegisterName("app/models.Filter", &Filter{})
+	gob.RegisterName("app/models.RandCursor", &RandCursor{})
 
 	database = db_session.DB("").Name
 	Router = pat.New()
@@ -64,6 +65,42 @@ func init() {
 	if err := db_session.DB(database).C("users").EnsureIndexKey("country"); err != nil {
 		log.Print("context: ", err)
 	}
+	if err := db_session.DB(database).C("photos").EnsureIndexKey("active", "-score.wilson"); err != nil {
+		log.Print("context: ", err)
+	}
+	if err := db_session.DB(database).C("photos").EnsureIndexKey("active", "-score.bayes"); err != nil {
+		log.Print("context: ", err)
+	}
+	if err := db_session.DB(database).C("photos").EnsureIndexKey("active", "-score.engagement"); err != nil {
+		log.Print("context: ", err)
+	}
+	// one vote per user and photo, in or out of a contest
+	if err := db_session.DB(database).C("votes").EnsureIndex(mgo.Index{
+		Key:    []string{"photo", "user", "contest"},
+		Unique: true,
+	}); err != nil {
+		log.Print("context: ", err)
+	}
+	if err := db_session.DB(database).C("votes").EnsureIndexKey("updatedon"); err != nil {
+		log.Print("context: ", err)
+	}
+	if err := db_session.DB(database).C("photos").EnsureIndexKey("active", "rand", "_id"); err != nil {
+		log.Print("context: ", err)
+	}
+	if err := db_session.DB(database).C("photos").EnsureIndexKey("active", "altrand", "_id"); err != nil {
+		log.Print("context: ", err)
+	}
+	if err := db_session.DB(database).C("contests").EnsureIndexKey("nexttransition"); err != nil {
+		log.Print("context: ", err)
+	}
+	if err := db_session.DB(database).C("contests").EnsureIndexKey("state"); err != nil {
+		log.Print("context: ", err)
+	}
+	ensureCommentIndexes(db_session.DB(database))
+	ensureViewIndexes(db_session.DB(database))
+	ensureEloIndexes(db_session.DB(database))
+	ensureJuryIndexes(db_session.DB(database))
+	ensureSeriesIndexes(db_session.DB(database))
 	store = sessions.NewCookieStore([]byte("508a664e65427d3f91000001"))
 	if sentry, err = raven.NewClient(SENTRY_DSN); err != nil {
 		log.Print("could not connect to sentry: ", err)
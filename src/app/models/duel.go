@@ -0,0 +1,227 @@
+package models
+
+import (
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"math"
+	"time"
+)
+
+// RANK_ELO judges the photos by the head to head comparisons instead of
+// the heart votes.
+const RANK_ELO = "elo"
+
+const (
+	ELO_INITIAL = 1500.0
+	ELO_K       = 32.0
+)
+
+// Duel records the preference of a user between two photos.
+type Duel struct {
+	Id        bson.ObjectId `bson:"_id,omitempty"`
+	User      bson.ObjectId
+	Winner    bson.ObjectId
+	Loser     bson.ObjectId
+	Pair      string        // the two photos whatever the winner
+	Contest   bson.ObjectId `bson:"contest,omitempty"`
+	CreatedOn time.Time
+}
+
+// pairKey identifies the two photos of a duel in any order.
+func pairKey(a, b bson.ObjectId) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a.Hex() + b.Hex()
+}
+
+// Elo is the rating of a photo, global or inside a contest.
+type Elo struct {
+	Id      bson.ObjectId `bson:"_id,omitempty"`
+	Photo   bson.ObjectId
+	Contest bson.ObjectId `bson:"contest,omitempty"`
+	Rating  float64
+	Games   int
+}
+
+// EloExpected is the probability of a win for a rating against another.
+func EloExpected(rating, other float64) float64 {
+	return 1 / (1 + math.Pow(10, (other-rating)/400))
+}
+
+// EloUpdate returns the new ratings of the winner and the loser.
+func EloUpdate(winner, loser float64) (float64, float64) {
+	delta := eloDelta(winner, loser)
+	return winner + delta, loser - delta
+}
+
+// eloDelta is the rating moved from the loser to the winner.
+func eloDelta(winner, loser float64) float64 {
+	return ELO_K * (1 - EloExpected(winner, loser))
+}
+
+// contestQuery matches the global documents or the ones of the contest.
+func contestQuery(contest bson.ObjectId) bson.M {
+	if contest == "" {
+		return bson.M{"contest": bson.M{"$exists": false}}
+	}
+	return bson.M{"contest": contest}
+}
+
+func eloQuery(photo, contest bson.ObjectId) bson.M {
+	query := contestQuery(contest)
+	query["photo"] = photo
+	return query
+}
+
+func getElo(ctx *Context, photo, contest bson.ObjectId) (*Elo, error) {
+	e := &Elo{}
+	err := ctx.C("elo").Find(eloQuery(photo, contest)).One(e)
+	if err == mgo.ErrNotFound {
+		return &Elo{Photo: photo, Contest: contest, Rating: ELO_INITIAL}, nil
+	}
+	return e, err
+}
+
+// incElo moves the rating of the photo by delta. The delta is applied
+// with $inc so the concurrent duels of the photo all count.
+func incElo(ctx *Context, photo, contest bson.ObjectId, delta float64) error {
+	inc := bson.M{"$inc": bson.M{"rating": delta, "games": 1}}
+	err := ctx.C("elo").Update(eloQuery(photo, contest), inc)
+	if err != mgo.ErrNotFound {
+		return err
+	}
+	err = ctx.C("elo").Insert(&Elo{Photo: photo, Contest: contest, Rating: ELO_INITIAL + delta, Games: 1})
+	if mgo.IsDup(err) { // created by a concurrent duel
+		return ctx.C("elo").Update(eloQuery(photo, contest), inc)
+	}
+	return err
+}
+
+// RecordDuel saves the preference of the user and updates the ratings of
+// the two photos. A user judges a pair only once, the unique index on the
+// pair ignores the later choices.
+func RecordDuel(ctx *Context, d *Duel) error {
+	d.Pair = pairKey(d.Winner, d.Loser)
+	d.CreatedOn = time.Now()
+	if err := ctx.C("duels").Insert(d); err != nil {
+		if mgo.IsDup(err) {
+			return nil
+		}
+		return err
+	}
+	w, err := getElo(ctx, d.Winner, d.Contest)
+	if err != nil {
+		return err
+	}
+	l, err := getElo(ctx, d.Loser, d.Contest)
+	if err != nil {
+		return err
+	}
+	delta := eloDelta(w.Rating, l.Rating)
+	if err := incElo(ctx, d.Winner, d.Contest, delta); err != nil {
+		return err
+	}
+	return incElo(ctx, d.Loser, d.Contest, -delta)
+}
+
+// DuelPair picks two random photos matching the query for the user to
+// compare.
+func DuelPair(ctx *Context, query bson.M) ([]*Photo, error) {
+	photos, err := RandomPhotos(ctx, query, NewRandCursor(), 2)
+	if err != nil || len(photos) < 2 {
+		return nil, err
+	}
+	return photos, nil
+}
+
+// EloRanking returns the photos ordered by their head to head rating,
+// globally or inside a contest.
+func EloRanking(ctx *Context, contest bson.ObjectId, skip, limit int) (ranked []*Ranked, max int, err error) {
+	query := contestQuery(contest)
+	if max, err = ctx.C("elo").Find(query).Count(); err != nil {
+		return
+	}
+	var elos []*Elo
+	q := ctx.C("elo").Find(query).Sort("-rating").Skip(skip)
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err = q.All(&elos); err != nil {
+		return
+	}
+	for _, e := range elos {
+		ranked = append(ranked, &Ranked{Photo: e.Photo, Rank: e.Rating, Count: e.Games})
+	}
+	return
+}
+
+func ensureEloIndexes(db *mgo.Database) {
+	if err := db.C("elo").EnsureIndex(mgo.Index{Key: []string{"photo", "contest"}, Unique: true}); err != nil {
+		Log("elo index: ", err.Error())
+	}
+	if err := db.C("elo").EnsureIndexKey("contest", "-rating"); err != nil {
+		Log("elo index: ", err.Error())
+	}
+	// fails on the duels recorded before the pair was kept until the
+	// duels migration is run
+	if err := ensureDuelIndex(db); err != nil {
+		Log("duels index: ", err.Error())
+	}
+}
+
+func ensureDuelIndex(db *mgo.Database) error {
+	return db.C("duels").EnsureIndex(mgo.Index{Key: []string{"user", "pair", "contest"}, Unique: true})
+}
+
+// MigrateDuels sets the pair of the older duels, removes the repeated ones
+// left by concurrent votes and adds the index keeping them unique.
+func MigrateDuels() error {
+	db := db_session.Clone().DB(database)
+	defer db.Session.Close()
+	if err := backfillDuelPairs(db); err != nil {
+		return err
+	}
+	if err := dedupeDuels(db); err != nil {
+		return err
+	}
+	return ensureDuelIndex(db)
+}
+
+// dedupeDuels keeps the first duel of every user, pair and contest.
+func dedupeDuels(db *mgo.Database) error {
+	var dups []struct {
+		Ids []bson.ObjectId
+	}
+	err := db.C("duels").Pipe([]bson.M{
+		{"$sort": bson.M{"_id": 1}},
+		{"$group": bson.M{
+			"_id":   bson.M{"user": "$user", "pair": "$pair", "contest": "$contest"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	}).All(&dups)
+	if err != nil {
+		return err
+	}
+	for _, d := range dups {
+		if _, err := db.C("duels").RemoveAll(bson.M{"_id": bson.M{"$in": d.Ids[1:]}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillDuelPairs sets the pair of the duels recorded before it was kept.
+func backfillDuelPairs(db *mgo.Database) error {
+	var d Duel
+	iter := db.C("duels").Find(bson.M{"pair": bson.M{"$exists": false}}).Iter()
+	for iter.Next(&d) {
+		if err := db.C("duels").UpdateId(d.Id, bson.M{"$set": bson.M{"pair": pairKey(d.Winner, d.Loser)}}); err != nil {
+			return err
+		}
+		d = Duel{}
+	}
+	return iter.Close()
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"strings"
+	"time"
+)
+
+// reasons for refusing an entry
+const (
+	INELIGIBLE_INACTIVE    = "The photo is not active"
+	INELIGIBLE_COUNTRY     = "The photo is from another country"
+	INELIGIBLE_LOCATION    = "The photo is from another city"
+	INELIGIBLE_GENDER      = "The photo is of the other gender"
+	INELIGIBLE_TOO_YOUNG   = "The person in the photo is too young"
+	INELIGIBLE_TOO_OLD     = "The person in the photo is too old"
+	INELIGIBLE_NEW_ACCOUNT = "Your account is too new for this contest"
+	INELIGIBLE_MAX_ENTRIES = "You reached the maximum number of entries"
+	INELIGIBLE_ENTERED     = "The photo is already in the contest"
+	INELIGIBLE_REJECTED    = "The photo was rejected, please enter a different one"
+)
+
+// MAX_ENTRIES bounds the entries per user an owner can allow.
+const MAX_ENTRIES = 10
+
+// EntryLimit is the number of photos a user can enter.
+func (c *Contest) EntryLimit() int {
+	if c.MaxEntries < 1 {
+		return 1
+	}
+	return c.MaxEntries
+}
+
+// entryCount is the field counting the live entries of the user, kept up
+// by every entry added, withdrawn or rejected.
+func entryCount(user bson.ObjectId) string {
+	return "entrycount." + user.Hex()
+}
+
+// EntriesLeft is the selector matching the contest only while the user has
+// fewer entries than the limit, so concurrent registrations cannot exceed
+// it.
+func (c *Contest) EntriesLeft(user bson.ObjectId) bson.M {
+	return bson.M{entryCount(user): bson.M{"$not": bson.M{"$gte": c.EntryLimit()}}}
+}
+
+// CountEntries is the increment of the entry count of the user.
+func CountEntries(user bson.ObjectId, n int) bson.M {
+	return bson.M{entryCount(user): n}
+}
+
+// Entries returns the entries of the user that were not rejected.
+func (c *Contest) Entries(user bson.ObjectId) (entries []*RegItem) {
+	for _, ri := range c.Registered {
+		if ri.User == user && !ri.Rejected {
+			entries = append(entries, ri)
+		}
+	}
+	return
+}
+
+// PhotoEntry returns the entry of the photo.
+func (c *Contest) PhotoEntry(photo bson.ObjectId) *RegItem {
+	for _, ri := range c.Registered {
+		if ri.Photo == photo {
+			return ri
+		}
+	}
+	return nil
+}
+
+// Entered tells if the photo is already in the contest.
+func (c *Contest) Entered(photo bson.ObjectId) bool {
+	return c.PhotoEntry(photo) != nil
+}
+
+// UserIneligibility returns the reasons the user cannot enter the contest.
+func (c *Contest) UserIneligibility(u *User) (reasons []string) {
+	if c.MinAccountDays > 0 && u.Id.Time().After(time.Now().AddDate(0, 0, -c.MinAccountDays)) {
+		reasons = append(reasons, INELIGIBLE_NEW_ACCOUNT)
+	}
+	// a single entry is replaced by the new one
+	if c.EntryLimit() > 1 && len(c.Entries(u.Id)) >= c.EntryLimit() {
+		reasons = append(reasons, INELIGIBLE_MAX_ENTRIES)
+	}
+	return
+}
+
+// PhotoIneligibility returns the reasons the photo does not match the
+// contest rules.
+func (c *Contest) PhotoIneligibility(p *Photo) (reasons []string) {
+	if !p.Active || p.Deleted {
+		reasons = append(reasons, INELIGIBLE_INACTIVE)
+	}
+	if c.Country != "" && !strings.EqualFold(p.Country, c.Country) {
+		reasons = append(reasons, INELIGIBLE_COUNTRY)
+	}
+	if c.Location != "" && !strings.EqualFold(p.Location, c.Location) {
+		reasons = append(reasons, INELIGIBLE_LOCATION)
+	}
+	if c.Gender != "" && p.Gender != c.Gender {
+		reasons = append(reasons, INELIGIBLE_GENDER)
+	}
+	if c.MinAge > 0 && p.Age < c.MinAge {
+		reasons = append(reasons, INELIGIBLE_TOO_YOUNG)
+	}
+	if c.MaxAge > 0 && p.Age > c.MaxAge {
+		reasons = append(reasons, INELIGIBLE_TOO_OLD)
+	}
+	return
+}
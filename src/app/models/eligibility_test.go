@@ -0,0 +1,53 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPhotoIneligibility(t *testing.T) {
+	c := &Contest{Country: "Romania", Gender: "f", MinAge: 18, MaxAge: 30}
+	tests := []struct {
+		name  string
+		photo *Photo
+		want  []string
+	}{
+		{"eligible", &Photo{Active: true, Country: "romania", Gender: "f", Age: 20}, nil},
+		{"inactive", &Photo{Country: "Romania", Gender: "f", Age: 20}, []string{INELIGIBLE_INACTIVE}},
+		{"country", &Photo{Active: true, Country: "Italy", Gender: "f", Age: 20}, []string{INELIGIBLE_COUNTRY}},
+		{"gender and young", &Photo{Active: true, Country: "Romania", Gender: "m", Age: 16}, []string{INELIGIBLE_GENDER, INELIGIBLE_TOO_YOUNG}},
+		{"old", &Photo{Active: true, Country: "Romania", Gender: "f", Age: 31}, []string{INELIGIBLE_TOO_OLD}},
+	}
+	for _, tt := range tests {
+		if got := c.PhotoIneligibility(tt.photo); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUserIneligibility(t *testing.T) {
+	old := &User{Id: bson.NewObjectIdWithTime(time.Now().AddDate(0, 0, -30))}
+	fresh := &User{Id: bson.NewObjectId()}
+	entries := []*RegItem{{User: old.Id, Photo: bson.NewObjectId()}, {User: old.Id, Photo: bson.NewObjectId()}}
+	tests := []struct {
+		name    string
+		contest *Contest
+		user    *User
+		want    []string
+	}{
+		{"no rules", &Contest{}, fresh, nil},
+		{"new account", &Contest{MinAccountDays: 7}, fresh, []string{INELIGIBLE_NEW_ACCOUNT}},
+		{"old account", &Contest{MinAccountDays: 7}, old, nil},
+		{"single entry is replaced", &Contest{Registered: entries[:1]}, old, nil},
+		{"entries left", &Contest{MaxEntries: 3, Registered: entries}, old, nil},
+		{"no entries left", &Contest{MaxEntries: 2, Registered: entries}, old, []string{INELIGIBLE_MAX_ENTRIES}},
+		{"rejected entries do not count", &Contest{MaxEntries: 3, Registered: append(entries, &RegItem{User: old.Id, Photo: bson.NewObjectId(), Rejected: true})}, old, nil},
+	}
+	for _, tt := range tests {
+		if got := tt.contest.UserIneligibility(tt.user); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// CanWithdraw tells if the entries can still be withdrawn or replaced.
+func (c *Contest) CanWithdraw() bool {
+	return c.CanRegister() && time.Now().Before(c.AdmissionDeadline)
+}
+
+// Entry returns the entry of the user with the photo, unless rejected.
+func (c *Contest) Entry(user, photo bson.ObjectId) *RegItem {
+	for _, ri := range c.Registered {
+		if ri.User == user && ri.Photo == photo && !ri.Rejected {
+			return ri
+		}
+	}
+	return nil
+}
+
+// WithdrawEntry takes the photo of the user out of the contest while the
+// admission is open. It returns mgo.ErrNotFound when there is no such entry.
+func WithdrawEntry(ctx *Context, contest, user, photo bson.ObjectId) error {
+	entry := bson.M{"user": user, "photo": photo, "rejected": bson.M{"$ne": true}}
+	return ctx.C("contests").Update(bson.M{
+		"_id":               contest,
+		"state":             STATE_ADMISSION,
+		"admissiondeadline": bson.M{"$gt": time.Now()},
+		"registered":        bson.M{"$elemMatch": entry},
+	}, bson.M{"$pull": bson.M{"registered": entry}, "$inc": CountEntries(user, -1)})
+}
+
+// WithdrawPhoto takes the photo of the user out of all the contests still
+// accepting entries, the contests already voting keep it. The rejected
+// entries stay as a record of the rejection.
+func WithdrawPhoto(ctx *Context, user, photo bson.ObjectId) error {
+	entry := bson.M{"user": user, "photo": photo, "rejected": bson.M{"$ne": true}}
+	_, err := ctx.C("contests").UpdateAll(bson.M{
+		"state":      bson.M{"$in": []string{STATE_PUBLISHED, STATE_ADMISSION}},
+		"registered": bson.M{"$elemMatch": entry},
+	}, bson.M{"$pull": bson.M{"registered": entry}, "$inc": CountEntries(user, -1)})
+	return err
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"sync"
+)
+
+const (
+	CONTESTS_TOPIC = "contests"
+	EVENT_BUFFER   = 16
+)
+
+type Event struct {
+	Topic string      `json:"-"`
+	Kind  string      `json:"kind"`
+	Data  interface{} `json:"data"`
+}
+
+// Broker distributes events to the subscribed sessions. The in-process
+// implementation can be replaced with a distributed one by setting Events.
+type Broker interface {
+	Subscribe(topics ...string) chan *Event
+	Unsubscribe(ch chan *Event)
+	Publish(e *Event)
+}
+
+var Events Broker = NewLocalBroker()
+
+func UserTopic(id bson.ObjectId) string {
+	return "user:" + id.Hex()
+}
+
+func PhotoTopic(id bson.ObjectId) string {
+	return "photo:" + id.Hex()
+}
+
+func ContestTopic(id bson.ObjectId) string {
+	return "contest:" + id.Hex()
+}
+
+func Publish(topic, kind string, data interface{}) {
+	Events.Publish(&Event{Topic: topic, Kind: kind, Data: data})
+}
+
+type localBroker struct {
+	sync.RWMutex
+	subs map[chan *Event][]string
+}
+
+func NewLocalBroker() Broker {
+	return &localBroker{subs: make(map[chan *Event][]string)}
+}
+
+func (b *localBroker) Subscribe(topics ...string) chan *Event {
+	ch := make(chan *Event, EVENT_BUFFER)
+	b.Lock()
+	b.subs[ch] = topics
+	b.Unlock()
+	return ch
+}
+
+func (b *localBroker) Unsubscribe(ch chan *Event) {
+	b.Lock()
+	defer b.Unlock()
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *localBroker) Publish(e *Event) {
+	b.RLock()
+	defer b.RUnlock()
+	for ch, topics := range b.subs {
+		for _, t := range topics {
+			if t == e.Topic {
+				select {
+				case ch <- e:
+				default: // slow subscriber, drop the event
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"errors"
+	"labix.org/v2/mgo/bson"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const MAX_SAVED_FILTERS = 10
+
+// FilterParams are the url parameters holding the filter state.
+var FilterParams = []string{"country", "location", "age", "gender"}
+
+// ParseFilter reads a filter from the url or form values.
+func ParseFilter(v url.Values) (*Filter, error) {
+	f := &Filter{
+		Name:     strings.TrimSpace(v.Get("name")),
+		Country:  strings.TrimSpace(v.Get("country")),
+		Location: strings.TrimSpace(v.Get("location")),
+		Gender:   strings.TrimSpace(v.Get("gender")),
+	}
+	if err := f.ParseAge(v.Get("age")); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// HasFilter tells if the url values carry a filter state.
+func HasFilter(v url.Values) bool {
+	for _, p := range FilterParams {
+		if _, ok := v[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Query encodes the filter as url parameters, so the filtered pages can
+// be bookmarked and shared.
+func (f *Filter) Query() string {
+	v := url.Values{}
+	if f.Country != "" {
+		v.Set("country", f.Country)
+	}
+	if f.Location != "" {
+		v.Set("location", f.Location)
+	}
+	if f.MinAge != 0 || f.MaxAge != 0 {
+		age := strconv.Itoa(f.MinAge)
+		if f.MaxAge != f.MinAge {
+			age += "-" + strconv.Itoa(f.MaxAge)
+		}
+		v.Set("age", age)
+	}
+	if f.Gender != "" {
+		v.Set("gender", f.Gender)
+	}
+	return v.Encode()
+}
+
+func (f *Filter) Empty() bool {
+	return f.Query() == ""
+}
+
+// SaveFilter stores the filter in the profile of the user replacing the
+// one with the same name.
+func SaveFilter(ctx *Context, f *Filter) error {
+	if f.Name == "" {
+		return errors.New("Missing filter name")
+	}
+	if err := DeleteFilter(ctx, f.Name); err != nil {
+		return err
+	}
+	if len(ctx.User.Filters) >= MAX_SAVED_FILTERS {
+		return errors.New("Too many saved filters")
+	}
+	if err := ctx.C("users").UpdateId(ctx.User.Id, bson.M{"$push": bson.M{"filters": f}}); err != nil {
+		return err
+	}
+	ctx.User.Filters = append(ctx.User.Filters, f)
+	return nil
+}
+
+// DeleteFilter removes the named filter from the profile of the user.
+func DeleteFilter(ctx *Context, name string) error {
+	if err := ctx.C("users").UpdateId(ctx.User.Id, bson.M{"$pull": bson.M{"filters": bson.M{"name": name}}}); err != nil {
+		return err
+	}
+	var kept []*Filter
+	for _, f := range ctx.User.Filters {
+		if f.Name != name {
+			kept = append(kept, f)
+		}
+	}
+	ctx.User.Filters = kept
+	return nil
+}
+
+// SavedFilter returns the named filter of the user.
+func (u *User) SavedFilter(name string) *Filter {
+	for _, f := range u.Filters {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestFilterRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		str    string
+	}{
+		{"empty", Filter{}, ""},
+		{"country", Filter{Country: "Romania"}, "country: Romania"},
+		{"separators", Filter{Country: "Bosnia & Herzegovina", Location: "Cluj-Napoca, Ardeal=1?"}, "country: Bosnia & Herzegovina, location: Cluj-Napoca, Ardeal=1?"},
+		{"non ascii", Filter{Location: "Târgu Mureș"}, "location: Târgu Mureș"},
+		{"single age", Filter{MinAge: 30, MaxAge: 30}, "age: 30"},
+		{"age range", Filter{MinAge: 30, MaxAge: 40}, "age: 30 - 40"},
+		{"all", Filter{Country: "Romania", Location: "Iasi", MinAge: 20, MaxAge: 25, Gender: "f"}, "country: Romania, location: Iasi, age: 20 - 25, gender: f"},
+	}
+	for _, tt := range tests {
+		if s := tt.filter.String(); s != tt.str {
+			t.Errorf("%s: String() = %q, want %q", tt.name, s, tt.str)
+		}
+		v, err := url.ParseQuery(tt.filter.Query())
+		if err != nil {
+			t.Errorf("%s: Query() = %q: %v", tt.name, tt.filter.Query(), err)
+			continue
+		}
+		if HasFilter(v) == tt.filter.Empty() {
+			t.Errorf("%s: HasFilter(%q) = %v", tt.name, tt.filter.Query(), HasFilter(v))
+		}
+		f, err := ParseFilter(v)
+		if err != nil {
+			t.Errorf("%s: ParseFilter(%q): %v", tt.name, tt.filter.Query(), err)
+			continue
+		}
+		if !reflect.DeepEqual(*f, tt.filter) {
+			t.Errorf("%s: ParseFilter(%q) = %+v, want %+v", tt.name, tt.filter.Query(), *f, tt.filter)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, age := range []string{"abc", "30-", "-40", "20-30-40", "10-200"} {
+		if _, err := ParseFilter(url.Values{"age": {age}}); err == nil {
+			t.Errorf("ParseFilter(age=%q) accepted", age)
+		}
+	}
+}
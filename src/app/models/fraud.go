@@ -0,0 +1,224 @@
+package models
+
+import (
+	"fmt"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"math"
+	"time"
+)
+
+// reasons for flagging a voter
+const (
+	FLAG_BURST     = "burst"     // new account voting a lot in a short time
+	FLAG_EXTREME   = "extreme"   // only 1 or 5 hearts for a few owners
+	FLAG_SHARED_IP = "shared_ip" // many accounts voting from the same address, with another flag
+)
+
+const (
+	FLAG_DISTRUST      = 0.5 // distrust added by every flag
+	NEW_ACCOUNT_AGE    = 72 * time.Hour
+	BURST_WINDOW       = time.Hour
+	BURST_VOTES        = 30
+	EXTREME_MIN_VOTES  = 10
+	EXTREME_MAX_OWNERS = 3
+	IP_CLUSTER_SIZE    = 3
+)
+
+// WatchVotes periodically looks for suspicious voting patterns.
+func WatchVotes(interval time.Duration) {
+	for _ = range time.Tick(interval) {
+		if err := DetectFraud(); err != nil {
+			Log("error detecting fraud: ", err.Error())
+		}
+	}
+}
+
+// DetectFraud flags the voters matching any of the suspicious patterns.
+func DetectFraud() error {
+	db := db_session.Clone().DB(database)
+	defer db.Session.Close()
+	flagged := make(map[bson.ObjectId][]string)
+	for reason, detect := range map[string]func(*mgo.Database) ([]bson.ObjectId, error){
+		FLAG_BURST:     burstVoters,
+		FLAG_EXTREME:   extremeVoters,
+		FLAG_SHARED_IP: sharedIPVoters,
+	} {
+		users, err := detect(db)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			flagged[u] = append(flagged[u], reason)
+		}
+	}
+	for u, reasons := range flagged {
+		if err := flagVoter(db, u, reasons); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// burstVoters returns the new accounts that voted more than BURST_VOTES
+// times in the last BURST_WINDOW.
+func burstVoters(db *mgo.Database) (users []bson.ObjectId, err error) {
+	now := time.Now()
+	var result []struct {
+		User  bson.ObjectId `bson:"_id"`
+		Count int
+	}
+	err = db.C("votes").Pipe([]bson.M{
+		{"$match": bson.M{
+			"updatedon": bson.M{"$gt": now.Add(-BURST_WINDOW)},
+			"user":      bson.M{"$gt": bson.NewObjectIdWithTime(now.Add(-NEW_ACCOUNT_AGE))},
+		}},
+		{"$group": bson.M{"_id": "$user", "count": bson.M{"$sum": 1}}},
+		{"$match": bson.M{"count": bson.M{"$gt": BURST_VOTES}}},
+	}).All(&result)
+	for _, r := range result {
+		users = append(users, r.User)
+	}
+	return
+}
+
+// extremeVoters returns the accounts that only gave 1 or 5 hearts and
+// only to a handful of owners.
+func extremeVoters(db *mgo.Database) (users []bson.ObjectId, err error) {
+	var result []struct {
+		User     bson.ObjectId `bson:"_id"`
+		Count    int
+		Extremes int
+		Owners   []bson.ObjectId
+	}
+	err = db.C("votes").Pipe([]bson.M{
+		{"$group": bson.M{
+			"_id":   "$user",
+			"count": bson.M{"$sum": 1},
+			"extremes": bson.M{"$sum": bson.M{"$cond": []interface{}{
+				bson.M{"$or": []bson.M{{"$eq": []interface{}{"$score", 1}}, {"$eq": []interface{}{"$score", 5}}}}, 1, 0,
+			}}},
+			"owners": bson.M{"$addToSet": "$photouser"},
+		}},
+		{"$match": bson.M{"count": bson.M{"$gte": EXTREME_MIN_VOTES}}},
+	}).All(&result)
+	for _, r := range result {
+		if r.Extremes == r.Count && len(r.Owners) <= EXTREME_MAX_OWNERS {
+			users = append(users, r.User)
+		}
+	}
+	return
+}
+
+// sharedIPVoters returns the accounts voting from addresses used by at
+// least IP_CLUSTER_SIZE accounts.
+func sharedIPVoters(db *mgo.Database) (users []bson.ObjectId, err error) {
+	var result []struct {
+		IP    string `bson:"_id"`
+		Users []bson.ObjectId
+	}
+	err = db.C("votes").Pipe([]bson.M{
+		{"$match": bson.M{"ip": bson.M{"$exists": true}}},
+		{"$group": bson.M{"_id": "$ip", "users": bson.M{"$addToSet": "$user"}}},
+		{"$match": bson.M{fmt.Sprintf("users.%d", IP_CLUSTER_SIZE-1): bson.M{"$exists": true}}},
+	}).All(&result)
+	seen := make(map[bson.ObjectId]bool)
+	for _, r := range result {
+		for _, u := range r.Users {
+			if !seen[u] {
+				seen[u] = true
+				users = append(users, u)
+			}
+		}
+	}
+	return
+}
+
+// flagVoter records the reasons on the voter and lowers the weight of
+// the votes accordingly. Vetted voters are left alone and a shared address
+// alone, common behind a NAT, is not enough.
+func flagVoter(db *mgo.Database, id bson.ObjectId, reasons []string) error {
+	u := &User{}
+	if err := db.C("users").FindId(id).Select(bson.M{"flags": 1, "distrust": 1, "vetted": 1}).One(u); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	if u.Vetted {
+		return nil
+	}
+	flags := u.Flags
+	for _, r := range reasons {
+		found := false
+		for _, f := range flags {
+			if f == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			flags = append(flags, r)
+		}
+	}
+	if len(flags) == len(u.Flags) || len(flags) == 1 && flags[0] == FLAG_SHARED_IP {
+		return nil
+	}
+	distrust := math.Min(1, FLAG_DISTRUST*float64(len(flags)))
+	if err := db.C("users").UpdateId(id, bson.M{"$set": bson.M{"flags": flags, "distrust": distrust}}); err != nil {
+		return err
+	}
+	return setDistrust(db, id, distrust)
+}
+
+// setDistrust copies the distrust on the votes of the voter and
+// recomputes the scores of the voted photos.
+func setDistrust(db *mgo.Database, user bson.ObjectId, distrust float64) error {
+	var photos []bson.ObjectId
+	if err := db.C("votes").Find(bson.M{"user": user}).Distinct("photo", &photos); err != nil {
+		return err
+	}
+	update := bson.M{"$set": bson.M{"distrust": distrust}}
+	if distrust == 0 {
+		update = bson.M{"$unset": bson.M{"distrust": 1}}
+	}
+	if _, err := db.C("votes").UpdateAll(bson.M{"user": user}, update); err != nil {
+		return err
+	}
+	return rescorePhotos(db, photos)
+}
+
+// VoidVotes removes all the votes of the voter.
+func VoidVotes(ctx *Context, user bson.ObjectId) error {
+	var photos []bson.ObjectId
+	if err := ctx.C("votes").Find(bson.M{"user": user}).Distinct("photo", &photos); err != nil {
+		return err
+	}
+	if _, err := ctx.C("votes").RemoveAll(bson.M{"user": user}); err != nil {
+		return err
+	}
+	return rescorePhotos(ctx.Database, photos)
+}
+
+// VetVoter clears the flags of the voter and restores the full weight of
+// the votes. The voter will not be flagged again.
+func VetVoter(ctx *Context, user bson.ObjectId) error {
+	if err := ctx.C("users").UpdateId(user, bson.M{
+		"$set":   bson.M{"vetted": true},
+		"$unset": bson.M{"flags": 1, "distrust": 1},
+	}); err != nil {
+		return err
+	}
+	return setDistrust(ctx.Database, user, 0)
+}
+
+// VoteWeight is the weight applied to the votes of the user.
+func (u *User) VoteWeight() float64 {
+	return 1 - u.Distrust
+}
+
+// FlaggedVoters returns the voters flagged and not yet vetted.
+func FlaggedVoters(ctx *Context) (users []*User, err error) {
+	err = ctx.C("users").Find(bson.M{"flags.0": bson.M{"$exists": true}}).Sort("-distrust").All(&users)
+	return
+}
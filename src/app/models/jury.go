@@ -0,0 +1,220 @@
+package models
+
+import (
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"sort"
+	"strings"
+	"time"
+)
+
+// contest judging modes
+const (
+	JUDGING_PUBLIC = "public" // the logged in users vote
+	JUDGING_JURY   = "jury"   // only the jurors score the entries
+	JUDGING_MIXED  = "mixed"  // jury and public ranks weighted together
+)
+
+const (
+	MAX_CRITERIA        = 5
+	DEFAULT_JURY_WEIGHT = 50 // percent of the jury in mixed contests
+	MIN_MARK            = 1  // the scale of the jurors marks
+	MAX_MARK            = 5
+)
+
+var DEFAULT_CRITERIA = []string{"Beauty", "Expression", "Photo quality"}
+
+// JuryScore holds the marks of a juror for an entry, one for every contest
+// criterion.
+type JuryScore struct {
+	Id        bson.ObjectId `bson:"_id,omitempty"`
+	Contest   bson.ObjectId
+	Photo     bson.ObjectId
+	Juror     bson.ObjectId
+	Scores    []float64
+	UpdatedOn time.Time
+}
+
+// Average is the mean of the criteria marks.
+func (js *JuryScore) Average() float64 {
+	if len(js.Scores) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, s := range js.Scores {
+		sum += s
+	}
+	return sum / float64(len(js.Scores))
+}
+
+// JudgingMode returns the judging mode, public for the older contests.
+func (c *Contest) JudgingMode() string {
+	if c.Judging == "" {
+		return JUDGING_PUBLIC
+	}
+	return c.Judging
+}
+
+// PublicVoting tells if the users can vote the entries.
+func (c *Contest) PublicVoting() bool {
+	return c.JudgingMode() != JUDGING_JURY
+}
+
+// HasJury tells if the jury scores count for the contest.
+func (c *Contest) HasJury() bool {
+	return c.JudgingMode() != JUDGING_PUBLIC
+}
+
+// JudgingCriteria returns the criteria the jurors score on.
+func (c *Contest) JudgingCriteria() []string {
+	if len(c.Criteria) == 0 {
+		return DEFAULT_CRITERIA
+	}
+	return c.Criteria
+}
+
+// IsJuror tells if the user is in the contest jury.
+func (c *Contest) IsJuror(user bson.ObjectId) bool {
+	return hasMember(c.Jurors, user)
+}
+
+// juryShare is the weight of the jury rank in the standings.
+func (c *Contest) juryShare() float64 {
+	switch c.JudgingMode() {
+	case JUDGING_JURY:
+		return 1
+	case JUDGING_MIXED:
+		return float64(c.JuryWeight) / 100
+	}
+	return 0
+}
+
+// ParseCriteria splits the comma separated criteria of the contest form.
+func ParseCriteria(s string) (criteria []string) {
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			criteria = append(criteria, c)
+		}
+	}
+	return
+}
+
+// AddJuror puts the user in the jury and tells them about it.
+func AddJuror(ctx *Context, c *Contest, u *User) error {
+	j := &Member{Id: u.Id, Name: u.FullName()}
+	err := ctx.C("contests").Update(bson.M{"_id": c.Id, "jurors._id": bson.M{"$ne": u.Id}}, bson.M{"$push": bson.M{"jurors": j}})
+	if err != nil {
+		return err
+	}
+	body := "You were invited in the jury of the contest " + c.Name + ". You can score the entries during the voting."
+	if err := notifyContest(ctx, c, u.Id, "jury", body); err != nil {
+		Log("error inviting juror: ", err.Error())
+	}
+	Publish(UserTopic(u.Id), "jury_invite", map[string]string{"id": c.Id.Hex(), "name": c.Name})
+	return nil
+}
+
+// RemoveJuror takes the user out of the jury, the scores given are dropped.
+func RemoveJuror(ctx *Context, contest, user bson.ObjectId) error {
+	if err := ctx.C("contests").UpdateId(contest, bson.M{"$pull": bson.M{"jurors": bson.M{"_id": user}}}); err != nil {
+		return err
+	}
+	_, err := ctx.C("jury").RemoveAll(bson.M{"contest": contest, "juror": user})
+	return err
+}
+
+// ScoreEntry saves the marks of the juror for the photo.
+func ScoreEntry(ctx *Context, js *JuryScore) error {
+	js.UpdatedOn = time.Now()
+	_, err := ctx.C("jury").Upsert(bson.M{"contest": js.Contest, "photo": js.Photo, "juror": js.Juror}, bson.M{"$set": bson.M{
+		"scores":    js.Scores,
+		"updatedon": js.UpdatedOn,
+	}})
+	return err
+}
+
+// JurorScores returns the marks given by the juror keyed by photo.
+func JurorScores(ctx *Context, contest, juror bson.ObjectId) (map[bson.ObjectId]*JuryScore, error) {
+	var scores []*JuryScore
+	if err := ctx.C("jury").Find(bson.M{"contest": contest, "juror": juror}).All(&scores); err != nil {
+		return nil, err
+	}
+	byPhoto := make(map[bson.ObjectId]*JuryScore, len(scores))
+	for _, js := range scores {
+		byPhoto[js.Photo] = js
+	}
+	return byPhoto, nil
+}
+
+// JuryRanking ranks the entries by the average of the jurors marks.
+func JuryRanking(ctx *Context, contest bson.ObjectId) ([]*Ranked, error) {
+	var scores []*JuryScore
+	if err := ctx.C("jury").Find(bson.M{"contest": contest}).All(&scores); err != nil {
+		return nil, err
+	}
+	byPhoto := make(map[bson.ObjectId]*Ranked)
+	var ranked []*Ranked
+	for _, js := range scores {
+		r, ok := byPhoto[js.Photo]
+		if !ok {
+			r = &Ranked{Photo: js.Photo}
+			byPhoto[js.Photo] = r
+			ranked = append(ranked, r)
+		}
+		r.Rank += js.Average()
+		r.Count++
+	}
+	for _, r := range ranked {
+		r.Rank /= float64(r.Count)
+	}
+	sort.Sort(rankedSorter(ranked))
+	return ranked, nil
+}
+
+// CombineRankings weights the jury and the public ranks. Both are scaled to
+// the 0-1 range first: the jury averages on the marks scale, the public ranks,
+// which may use any scale, between the lowest and the highest one. Equal
+// public ranks are placed in the middle of the range.
+func CombineRankings(jury, public []*Ranked, juryShare float64) []*Ranked {
+	byPhoto := make(map[bson.ObjectId]*Ranked)
+	var combined []*Ranked
+	add := func(ranked []*Ranked, share, min, max float64) {
+		for _, r := range ranked {
+			c, ok := byPhoto[r.Photo]
+			if !ok {
+				c = &Ranked{Photo: r.Photo}
+				byPhoto[r.Photo] = c
+				combined = append(combined, c)
+			}
+			if max > min {
+				c.Rank += share * (r.Rank - min) / (max - min)
+			} else {
+				c.Rank += share / 2
+			}
+			c.Count += r.Count
+		}
+	}
+	add(jury, juryShare, MIN_MARK, MAX_MARK)
+	min, max := rankBounds(public)
+	add(public, 1-juryShare, min, max)
+	sort.Stable(rankedSorter(combined))
+	return combined
+}
+
+func rankBounds(ranked []*Ranked) (min, max float64) {
+	for i, r := range ranked {
+		if i == 0 || r.Rank < min {
+			min = r.Rank
+		}
+		if i == 0 || r.Rank > max {
+			max = r.Rank
+		}
+	}
+	return
+}
+
+func ensureJuryIndexes(db *mgo.Database) {
+	if err := db.C("jury").EnsureIndex(mgo.Index{Key: []string{"contest", "photo", "juror"}, Unique: true}); err != nil {
+		Log("jury index: ", err.Error())
+	}
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"testing"
+)
+
+func TestCombineRankings(t *testing.T) {
+	a, b, c := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	jury := []*Ranked{{Photo: a, Rank: 5, Count: 2}, {Photo: b, Rank: 3, Count: 2}, {Photo: c, Rank: 1, Count: 2}}
+	public := []*Ranked{{Photo: c, Rank: 1600, Count: 10}, {Photo: b, Rank: 1500, Count: 10}, {Photo: a, Rank: 1400, Count: 10}}
+
+	combined := CombineRankings(jury, public, 0.75)
+	if len(combined) != 3 || combined[0].Photo != a || combined[1].Photo != b || combined[2].Photo != c {
+		t.Fatalf("jury majority: wrong order %v", combined)
+	}
+	if combined[0].Rank != 0.75 || combined[0].Count != 12 {
+		t.Errorf("jury majority: got rank %v count %d", combined[0].Rank, combined[0].Count)
+	}
+	if combined := CombineRankings(jury, public, 0.25); combined[0].Photo != c {
+		t.Errorf("public majority: expected the public favourite first")
+	}
+	// photos scored by a single side only get that side's share
+	combined = CombineRankings(jury[:1], public, 0.5)
+	if combined[0].Photo != a || combined[0].Rank != 0.5 {
+		t.Errorf("single jury score: got %v %v", combined[0].Photo, combined[0].Rank)
+	}
+	// a lone low jury mark keeps its place on the marks scale
+	combined = CombineRankings([]*Ranked{{Photo: a, Rank: 1}}, public, 0.5)
+	if combined[0].Photo != c || combined[0].Rank != 0.5 || combined[2].Photo != a || combined[2].Rank != 0 {
+		t.Errorf("lone low jury mark: got %v %v, %v %v", combined[0].Photo, combined[0].Rank, combined[2].Photo, combined[2].Rank)
+	}
+	// equal public ranks get half their share
+	combined = CombineRankings(nil, []*Ranked{{Photo: a, Rank: 0.8}, {Photo: b, Rank: 0.8}}, 0.5)
+	if combined[0].Rank != 0.25 || combined[1].Rank != 0.25 {
+		t.Errorf("equal public ranks: got %v %v", combined[0].Rank, combined[1].Rank)
+	}
+}
+
+func TestParseCriteria(t *testing.T) {
+	got := ParseCriteria(" Beauty, ,Smile ,")
+	if len(got) != 2 || got[0] != "Beauty" || got[1] != "Smile" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// contest states, in the order they are entered
+const (
+	STATE_DRAFT     = "draft"     // edited by the owner, not visible
+	STATE_PUBLISHED = "published" // visible, admission starts right away
+	STATE_ADMISSION = "admission" // accepting entries until the admission deadline
+	STATE_VOTING    = "voting"    // voting the entries until the voting deadline
+	STATE_CLOSED    = "closed"    // voting is over
+	STATE_RESULTS   = "results"   // final standings computed
+)
+
+// contestHook runs when a contest enters a state.
+type contestHook func(ctx *Context, c *Contest) error
+
+// contestHooks is only written by init so it is read without locking.
+var contestHooks = make(map[string][]contestHook)
+
+func onContestState(state string, hook contestHook) {
+	contestHooks[state] = append(contestHooks[state], hook)
+}
+
+func init() {
+	onContestState(STATE_ADMISSION, publishPhase)
+	onContestState(STATE_VOTING, freezeRegistrations)
+	onContestState(STATE_VOTING, publishPhase)
+	onContestState(STATE_CLOSED, publishPhase)
+	onContestState(STATE_RESULTS, computeResults)
+}
+
+// next returns the state following the current one and when it is due.
+func (c *Contest) next() (string, time.Time) {
+	switch c.State {
+	case STATE_PUBLISHED:
+		return STATE_ADMISSION, time.Time{}
+	case STATE_ADMISSION:
+		return STATE_VOTING, c.AdmissionDeadline
+	case STATE_VOTING:
+		return STATE_CLOSED, c.VotingDeadline
+	case STATE_CLOSED:
+		return STATE_RESULTS, time.Time{}
+	}
+	return "", time.Time{}
+}
+
+// due returns the state the contest enters by now, if any.
+func (c *Contest) due(now time.Time) string {
+	state, due := c.next()
+	if due.After(now) {
+		return ""
+	}
+	return state
+}
+
+// RunContests creates the due instances of the contest series and drives
+// the contests through their states. The time of the next transition is
+// stored on every contest so the pending transitions are caught up after a
+// restart. The contests created before the scheduler get their state
+// first.
+func RunContests(interval time.Duration) {
+	if err := MigrateLifecycle(); err != nil {
+		Log("error migrating contests: ", err.Error())
+	}
+	for {
+		if err := advanceContests(time.Now()); err != nil {
+			Log("error advancing contests: ", err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+func advanceContests(now time.Time) error {
+	ctx := &Context{Database: db_session.Clone().DB(database)}
+	defer ctx.Close()
+	if err := advanceSeries(ctx, now); err != nil {
+		Log("error creating series contests: ", err.Error())
+	}
+	var contests []*Contest
+	if err := ctx.C("contests").Find(bson.M{"nexttransition": bson.M{"$lte": now}}).All(&contests); err != nil {
+		return err
+	}
+	for _, c := range contests {
+		if err := advanceContest(ctx, c, now); err != nil {
+			Log("error advancing contest ", c.Id.Hex(), ": ", err.Error())
+		}
+	}
+	return nil
+}
+
+// advanceContest moves the contest through all the transitions due by now.
+// The hooks of a state run before the state is saved, so when one fails
+// the transition stays due and is retried on the next run. The hooks must
+// be safe to run again.
+func advanceContest(ctx *Context, c *Contest, now time.Time) error {
+	return c.advance(now, func(from string) (bool, error) {
+		for _, hook := range contestHooks[c.State] {
+			if err := hook(ctx, c); err != nil {
+				return false, err
+			}
+		}
+		return setState(ctx, c, from, now)
+	})
+}
+
+// advance steps the contest through the states due by now, calling enter
+// on every one. It goes back to the previous state when enter fails and
+// stops when enter tells that another process moved the contest first.
+func (c *Contest) advance(now time.Time, enter func(from string) (bool, error)) error {
+	for {
+		state := c.due(now)
+		if state == "" {
+			return nil
+		}
+		from := c.State
+		c.State = state
+		entered, err := enter(from)
+		if err != nil {
+			c.State = from
+			return err
+		}
+		if !entered {
+			return nil
+		}
+	}
+}
+
+// setState saves the state entered by the contest if it is still in the
+// from state, returning false when another process moved it first.
+func setState(ctx *Context, c *Contest, from string, now time.Time) (bool, error) {
+	set := bson.M{"state": c.State}
+	update := bson.M{"$set": set}
+	if following, due := c.next(); following == "" {
+		update["$unset"] = bson.M{"nexttransition": 1}
+	} else {
+		if due.IsZero() {
+			due = now
+		}
+		set["nexttransition"] = due
+	}
+	err := ctx.C("contests").Update(bson.M{"_id": c.Id, "state": from}, update)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// PublishContest makes a draft contest visible, the scheduler opens the
+// admission on its next run.
+func PublishContest(ctx *Context, id, user bson.ObjectId) error {
+	return ctx.C("contests").Update(bson.M{"_id": id, "user": user, "state": STATE_DRAFT}, bson.M{"$set": bson.M{
+		"public":         true,
+		"state":          STATE_PUBLISHED,
+		"nexttransition": time.Now(),
+	}})
+}
+
+func publishPhase(ctx *Context, c *Contest) error {
+	publishContest(c, "contest", map[string]string{"id": c.Id.Hex(), "name": c.Name, "phase": c.State})
+	return nil
+}
+
+// publishContest sends the event to the contest subscribers and, for the
+// listed contests only, to everybody.
+func publishContest(c *Contest, kind string, data interface{}) {
+	if c.Public && c.VisibilityMode() == VISIBILITY_PUBLIC {
+		Publish(CONTESTS_TOPIC, kind, data)
+	}
+	Publish(ContestTopic(c.Id), kind, data)
+}
+
+// freezeRegistrations rejects the entries not approved before the voting.
+func freezeRegistrations(ctx *Context, c *Contest) error {
+	var pending []bson.ObjectId
+	for _, ri := range c.ToBeApproved() {
+		pending = append(pending, ri.Photo)
+	}
+	RejectEntries(ctx, c, pending, REASON_NOT_APPROVED, "")
+	return nil
+}
+
+func computeResults(ctx *Context, c *Contest) error {
+	return CloseContest(ctx, c, true)
+}
+
+// MigrateLifecycle sets the state of the contests created before the
+// scheduler. The finished ones get their results without notifications.
+// It runs when the scheduler starts and does nothing once all the contests
+// have a state.
+func MigrateLifecycle() error {
+	ctx := &Context{Database: db_session.Clone().DB(database)}
+	defer ctx.Close()
+	now := time.Now()
+	var c Contest
+	iter := ctx.C("contests").Find(bson.M{"state": bson.M{"$exists": false}}).Iter()
+	for iter.Next(&c) {
+		set := bson.M{}
+		switch {
+		case !c.Public:
+			set["state"] = STATE_DRAFT
+		case now.Before(c.AdmissionDeadline):
+			set["state"], set["nexttransition"] = STATE_ADMISSION, c.AdmissionDeadline
+		case now.Before(c.VotingDeadline):
+			set["state"], set["nexttransition"] = STATE_VOTING, c.VotingDeadline
+		default:
+			c.State = STATE_RESULTS
+			if err := CloseContest(ctx, &c, false); err != nil {
+				return err
+			}
+			set["state"] = STATE_RESULTS
+		}
+		if err := ctx.C("contests").UpdateId(c.Id, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		c = Contest{}
+	}
+	return iter.Close()
+}
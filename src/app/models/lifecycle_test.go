@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContestNext(t *testing.T) {
+	at := time.Date(2013, 3, 10, 0, 0, 0, 0, time.UTC)
+	vt := at.AddDate(0, 0, 7)
+	tests := []struct {
+		state, next string
+		due         time.Time
+	}{
+		{STATE_DRAFT, "", time.Time{}},
+		{STATE_PUBLISHED, STATE_ADMISSION, time.Time{}},
+		{STATE_ADMISSION, STATE_VOTING, at},
+		{STATE_VOTING, STATE_CLOSED, vt},
+		{STATE_CLOSED, STATE_RESULTS, time.Time{}},
+		{STATE_RESULTS, "", time.Time{}},
+	}
+	for _, tt := range tests {
+		c := &Contest{State: tt.state, AdmissionDeadline: at, VotingDeadline: vt}
+		next, due := c.next()
+		if next != tt.next || !due.Equal(tt.due) {
+			t.Errorf("%s: got %q %v want %q %v", tt.state, next, due, tt.next, tt.due)
+		}
+	}
+}
+
+// TestContestTransitions drives the transitions due from a published
+// contest, failing or losing the race on the given state.
+func TestContestTransitions(t *testing.T) {
+	at := time.Date(2013, 3, 10, 0, 0, 0, 0, time.UTC)
+	vt := at.AddDate(0, 0, 7)
+	errHook := errors.New("hook failed")
+	tests := []struct {
+		now        time.Time
+		fail, lost string
+		want       string
+		state      string
+		err        error
+	}{
+		{at.Add(-time.Hour), "", "", "admission", STATE_ADMISSION, nil},
+		{at, "", "", "admission voting", STATE_VOTING, nil},
+		{vt.Add(-time.Hour), "", "", "admission voting", STATE_VOTING, nil},
+		{vt.Add(time.Hour), "", "", "admission voting closed results", STATE_RESULTS, nil},
+		{vt.Add(time.Hour), STATE_CLOSED, "", "admission voting", STATE_VOTING, errHook},
+		{vt.Add(time.Hour), "", STATE_VOTING, "admission", STATE_VOTING, nil},
+	}
+	for _, tt := range tests {
+		c := &Contest{State: STATE_PUBLISHED, AdmissionDeadline: at, VotingDeadline: vt}
+		var entered []string
+		err := c.advance(tt.now, func(from string) (bool, error) {
+			if c.State == tt.fail {
+				return false, errHook
+			}
+			if c.State == tt.lost {
+				return false, nil
+			}
+			entered = append(entered, c.State)
+			return true, nil
+		})
+		if got := strings.Join(entered, " "); got != tt.want || c.State != tt.state || err != tt.err {
+			t.Errorf("%v fail %q lost %q: got %q in %s (%v) want %q in %s (%v)", tt.now, tt.fail, tt.lost, got, c.State, err, tt.want, tt.state, tt.err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"labix.org/v2/mgo"
+	"time"
+)
+
+// ContestLimits bounds the contest deadlines, set by the admins.
+type ContestLimits struct {
+	Id               string `bson:"_id"`
+	MaxAdmissionDays int    // admission deadline from the contest creation
+	MaxVotingDays    int    // voting deadline from the contest creation
+}
+
+const CONTEST_LIMITS = "contests"
+
+var DefaultContestLimits = ContestLimits{Id: CONTEST_LIMITS, MaxAdmissionDays: 31, MaxVotingDays: 62}
+
+// GetContestLimits returns the limits saved by the admins or the defaults.
+func GetContestLimits(ctx *Context) *ContestLimits {
+	l := DefaultContestLimits
+	if err := ctx.C("settings").FindId(CONTEST_LIMITS).One(&l); err != nil && err != mgo.ErrNotFound {
+		Log("error loading contest limits: ", err.Error())
+	}
+	return &l
+}
+
+// SaveContestLimits stores the limits for the new contests.
+func SaveContestLimits(ctx *Context, l *ContestLimits) error {
+	l.Id = CONTEST_LIMITS
+	_, err := ctx.C("settings").UpsertId(l.Id, l)
+	return err
+}
+
+// CheckDeadlines validates the deadlines of a contest created at created,
+// returning the errors for the admission and for the voting deadline. A
+// changed admission deadline must be in the future, the saved one is kept
+// as it is.
+func (l *ContestLimits) CheckDeadlines(at, vt, saved, created, now time.Time) (admission, voting error) {
+	switch {
+	case !at.Equal(saved) && !at.After(now):
+		admission = errors.New("Must be in the future")
+	case at.After(created.AddDate(0, 0, l.MaxAdmissionDays)):
+		admission = fmt.Errorf("Admission deadline can be maximum %d days from the contest creation", l.MaxAdmissionDays)
+	}
+	switch {
+	case !vt.After(at):
+		voting = errors.New("Must be after the admission deadline")
+	case vt.After(created.AddDate(0, 0, l.MaxVotingDays)):
+		voting = fmt.Errorf("Voting deadline can be maximum %d days from the contest creation", l.MaxVotingDays)
+	}
+	return
+}
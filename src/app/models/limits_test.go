@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckDeadlines(t *testing.T) {
+	l := &ContestLimits{MaxAdmissionDays: 7, MaxVotingDays: 14}
+	now := time.Date(2013, 3, 1, 12, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return now.AddDate(0, 0, n) }
+	tests := []struct {
+		name              string
+		at, vt            time.Time
+		admission, voting bool // errors expected
+	}{
+		{"valid", day(5), day(10), false, false},
+		{"admission in the past", day(-1), day(10), true, false},
+		{"admission too far", day(8), day(10), true, false},
+		{"voting before admission", day(5), day(4), false, true},
+		{"voting too far", day(5), day(15), false, true},
+		{"voting at the limit", day(7), day(14), false, false},
+	}
+	for _, tt := range tests {
+		a, v := l.CheckDeadlines(tt.at, tt.vt, time.Time{}, now, now)
+		if (a != nil) != tt.admission || (v != nil) != tt.voting {
+			t.Errorf("%s: got %v, %v", tt.name, a, v)
+		}
+	}
+	// an edit days later keeps the window of the creation and the passed
+	// admission deadline already saved
+	later := day(6)
+	if a, v := l.CheckDeadlines(day(5), day(14), day(5), now, later); a != nil || v != nil {
+		t.Errorf("edit with the saved deadline: got %v, %v", a, v)
+	}
+	if a, _ := l.CheckDeadlines(day(5), day(14), day(4), now, later); a == nil {
+		t.Error("edit moving the deadline in the past accepted")
+	}
+	if a, v := l.CheckDeadlines(day(7), day(15), day(5), now, later); a != nil || v == nil {
+		t.Errorf("edit past the creation window: got %v, %v", a, v)
+	}
+}
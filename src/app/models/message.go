@@ -13,4 +13,19 @@ type Message struct {
 	Subject  string
 	Body     string
 	Read     bool
+	Contest  bson.ObjectId `bson:"contest,omitempty"` // sender of the notifications
+}
+
+// notifyContest sends a notification from the contest to the user. The
+// contest name stands for the sender name.
+func notifyContest(ctx *Context, c *Contest, to bson.ObjectId, subject, body string) error {
+	return ctx.C("messages").Insert(&Message{
+		Id:       bson.NewObjectId(),
+		From:     c.User,
+		To:       to,
+		UserName: c.Name,
+		Subject:  c.Name + ": " + subject,
+		Body:     body,
+		Contest:  c.Id,
+	})
 }
@@ -0,0 +1,13 @@
+package models
+
+// Migrations are one-off data maintenance commands, run with: cmo -migrate <name>
+var Migrations = map[string]func() error{
+	"comments": MigrateComments,
+	"authors":  RepairAuthors,
+	"scores":   RebuildScores,
+	"fraud":    DetectFraud,
+	"voters":   CopyVoterDemographics,
+	"random":   Randomize,
+	"contests": MigrateLifecycle,
+	"duels":    MigrateDuels,
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"errors"
+	"labix.org/v2/mgo/bson"
+)
+
+// contest roles
+const (
+	ROLE_OWNER     = "owner"     // created the contest
+	ROLE_ORGANIZER = "organizer" // invited by the owner to help
+)
+
+// contest permissions
+const (
+	PERM_EDIT     = "edit"     // edit, publish or delete the contest
+	PERM_MANAGE   = "manage"   // invite the organizers and the jurors
+	PERM_APPROVE  = "approve"  // approve or reject the entries
+	PERM_MODERATE = "moderate" // delete the comments on the contest
+	PERM_STATUS   = "status"   // see the entries and the standings
+)
+
+var rolePermissions = map[string][]string{
+	ROLE_OWNER:     {PERM_EDIT, PERM_MANAGE, PERM_APPROVE, PERM_MODERATE, PERM_STATUS},
+	ROLE_ORGANIZER: {PERM_APPROVE, PERM_MODERATE, PERM_STATUS},
+}
+
+// Member is a user with a part in the contest.
+type Member struct {
+	Id   bson.ObjectId `bson:"_id"`
+	Name string
+}
+
+func hasMember(members []*Member, user bson.ObjectId) bool {
+	for _, m := range members {
+		if m.Id == user {
+			return true
+		}
+	}
+	return false
+}
+
+// Role returns the role of the user in the contest, empty for the others.
+func (c *Contest) Role(user bson.ObjectId) string {
+	switch {
+	case user == c.User:
+		return ROLE_OWNER
+	case hasMember(c.Organizers, user):
+		return ROLE_ORGANIZER
+	}
+	return ""
+}
+
+// Allows tells if the user has the permission on the contest.
+func (c *Contest) Allows(user bson.ObjectId, perm string) bool {
+	for _, p := range rolePermissions[c.Role(user)] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Moderator lets the organizers delete the comments on the contest.
+func (c *Contest) Moderator(user bson.ObjectId) bool {
+	return c.Allows(user, PERM_MODERATE)
+}
+
+// OrganizerQuery matches the contests the user owns or organizes.
+func OrganizerQuery(user bson.ObjectId) bson.M {
+	return bson.M{"$or": []bson.M{{"user": user}, {"organizers._id": user}}}
+}
+
+// AddOrganizer gives the user the organizer role and tells them about it.
+func AddOrganizer(ctx *Context, c *Contest, u *User) error {
+	if u.Id == c.User {
+		return errors.New("The owner cannot be an organizer")
+	}
+	o := &Member{Id: u.Id, Name: u.FullName()}
+	err := ctx.C("contests").Update(bson.M{"_id": c.Id, "organizers._id": bson.M{"$ne": u.Id}}, bson.M{"$push": bson.M{"organizers": o}})
+	if err != nil {
+		return err
+	}
+	body := "You were invited to organize the contest " + c.Name + ". You can approve the entries and moderate the comments."
+	if err := notifyContest(ctx, c, u.Id, "organizer", body); err != nil {
+		Log("error inviting organizer: ", err.Error())
+	}
+	Publish(UserTopic(u.Id), "organizer_invite", map[string]string{"id": c.Id.Hex(), "name": c.Name})
+	return nil
+}
+
+// RemoveOrganizer takes the organizer role from the user.
+func RemoveOrganizer(ctx *Context, contest, user bson.ObjectId) error {
+	return ctx.C("contests").UpdateId(contest, bson.M{"$pull": bson.M{"organizers": bson.M{"_id": user}}})
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"testing"
+)
+
+func TestContestAllows(t *testing.T) {
+	owner, organizer, juror, other := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	c := &Contest{User: owner, Organizers: []*Member{{Id: organizer}}, Jurors: []*Member{{Id: juror}}}
+	tests := []struct {
+		user bson.ObjectId
+		perm string
+		want bool
+	}{
+		{owner, PERM_EDIT, true},
+		{owner, PERM_MANAGE, true},
+		{organizer, PERM_APPROVE, true},
+		{organizer, PERM_MODERATE, true},
+		{organizer, PERM_EDIT, false},
+		{organizer, PERM_MANAGE, false},
+		{juror, PERM_APPROVE, false},
+		{other, PERM_STATUS, false},
+	}
+	for _, tt := range tests {
+		if got := c.Allows(tt.user, tt.perm); got != tt.want {
+			t.Errorf("%s %s: got %v", c.Role(tt.user), tt.perm, got)
+		}
+	}
+}
@@ -34,8 +34,10 @@ type Photo struct {
 	AbuseCount                int
 	AbuseReporters            []bson.ObjectId
 	UpdatedOn                 time.Time
-	Comments                  []*Comment
+	CommentCount              int `bson:"commentcount,omitempty"`
 	Rand                      int64
+	AltRand                   int64 `bson:"altrand"`
+	Score                     Score `bson:"score,omitempty"`
 }
 
 func (p *Photo) SaveImage(img image.Image, x1, y1, x2, y2 int) error {
@@ -98,8 +100,8 @@ func (p *Photo) resize(img image.Image, fn string, w, h int) (image.Image, error
 	return err
 }*/
 
-func (p *Photo) CommentList() []*Comment {
-	return p.Comments
+func (p *Photo) Owner() bson.ObjectId {
+	return p.User
 }
 
 var (
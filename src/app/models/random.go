@@ -0,0 +1,135 @@
+package models
+
+import (
+	crand "crypto/rand"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"math/big"
+	"time"
+)
+
+// RAND_MAX bounds the rand fields of the photos and the session seeds.
+const RAND_MAX = 1000000
+
+// RandValue returns a random number in [0, RAND_MAX).
+func RandValue() int64 {
+	n, err := crand.Int(crand.Reader, big.NewInt(RAND_MAX))
+	if err != nil {
+		Log("error generating random number:", err.Error())
+		return 0
+	}
+	return n.Int64()
+}
+
+// the two fields ordering the random feed, the feed reads one while the
+// reshuffle writes the other
+const (
+	RAND_FIELD     = "rand"
+	ALT_RAND_FIELD = "altrand"
+)
+
+// RandField is the field ordering the random feed on the day of t. The
+// reshuffle only writes the field of the next day, so a session keeps the
+// same order until the day after it started.
+func RandField(t time.Time) string {
+	if t.Unix()/86400%2 == 0 {
+		return RAND_FIELD
+	}
+	return ALT_RAND_FIELD
+}
+
+// RandCursor is the position of a session in the random feed: the seed it
+// started from and the key of the last photo seen.
+type RandCursor struct {
+	Field   string
+	Seed    int64
+	Rand    int64
+	Id      bson.ObjectId
+	Wrapped bool // past the last photo, reading the ones before the seed
+}
+
+// NewRandCursor starts a session of the random feed from a new seed.
+func NewRandCursor() *RandCursor {
+	return &RandCursor{Field: RandField(time.Now()), Seed: RandValue()}
+}
+
+// RandomPhotos returns the next photos matching the query in the order of
+// their rand field and _id, starting from the seed of the cursor and
+// wrapping around, and moves the cursor past them. Paging from the last
+// key seen returns every photo once even when photos come and go.
+func RandomPhotos(ctx *Context, query bson.M, cur *RandCursor, limit int) (photos []*Photo, err error) {
+	for len(photos) < limit {
+		cond := []bson.M{{cur.Field: bson.M{"$gte": cur.Seed}}}
+		if cur.Wrapped {
+			cond = []bson.M{{cur.Field: bson.M{"$lt": cur.Seed}}}
+		}
+		if cur.Id != "" {
+			cond = append(cond, bson.M{"$or": []bson.M{
+				{cur.Field: bson.M{"$gt": cur.Rand}},
+				{cur.Field: cur.Rand, "_id": bson.M{"$gt": cur.Id}},
+			}})
+		}
+		q := bson.M{"$and": append(cond, query)}
+		var batch []*Photo
+		if err = ctx.C("photos").Find(q).Sort(cur.Field, "_id").Limit(limit - len(photos)).All(&batch); err != nil {
+			return
+		}
+		photos = append(photos, batch...)
+		if n := len(batch); n > 0 {
+			cur.Rand, cur.Id = batch[n-1].randKey(cur.Field), batch[n-1].Id
+		}
+		if len(photos) < limit {
+			if cur.Wrapped {
+				break
+			}
+			cur.Wrapped, cur.Id = true, ""
+		}
+	}
+	return
+}
+
+// randKey is the value of the rand field of the photo.
+func (p *Photo) randKey(field string) int64 {
+	if field == ALT_RAND_FIELD {
+		return p.AltRand
+	}
+	return p.Rand
+}
+
+// WatchRandom periodically reshuffles the photos so the random feed does
+// not keep the same neighbours together.
+func WatchRandom(interval time.Duration) {
+	if err := Randomize(); err != nil {
+		Log("error randomizing photos: ", err.Error())
+	}
+	for _ = range time.Tick(interval) {
+		if err := Randomize(); err != nil {
+			Log("error randomizing photos: ", err.Error())
+		}
+	}
+}
+
+// Randomize gives every photo a new value in the rand field of the next
+// day, leaving the order of the current sessions alone, and fills the field
+// of the current day where it is missing.
+func Randomize() error {
+	db := db_session.Clone().DB(database)
+	defer db.Session.Close()
+	now := time.Now()
+	today, next := RandField(now), RandField(now.Add(24*time.Hour))
+	iter := db.C("photos").Find(nil).Select(bson.M{"_id": 1, today: 1}).Iter()
+	for {
+		var p bson.M
+		if !iter.Next(&p) {
+			break
+		}
+		set := bson.M{next: RandValue()}
+		if _, ok := p[today]; !ok {
+			set[today] = RandValue()
+		}
+		if err := db.C("photos").UpdateId(p["_id"], bson.M{"$set": set}); err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return iter.Close()
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	RANK_WILSON   = "wilson"
+	RANK_BAYES    = "bayes"
+	RANK_TRENDING = "trending"
+	RANK_ENGAGING = "engaging"
+)
+
+// NEUTRAL_HEARTS is the vote that is neither positive nor negative.
+const NEUTRAL_HEARTS = 3
+
+// CONTEST_RANKINGS judge a contest by all its votes, the trending ranker
+// would drop the votes older than its window.
+var CONTEST_RANKINGS = []string{RANK_WILSON, RANK_BAYES, RANK_ELO}
+
+// Ranker orders the photos by their votes.
+type Ranker interface {
+	Rank(votes []*Vote, now time.Time) float64
+}
+
+// ScoreRanker is implemented by the rankers that only need the vote totals,
+// their rank is stored on the photo so the database can sort by it.
+type ScoreRanker interface {
+	Ranker
+	RankScore(s *Score) float64
+	Field() string
+}
+
+var Rankers = map[string]Ranker{
+	RANK_WILSON:   &WilsonRanker{Z: 1.96, Levels: 5},
+	RANK_BAYES:    &BayesianRanker{Prior: 3, Weight: 10},
+	RANK_TRENDING: &TrendingRanker{HalfLife: 48 * time.Hour, Window: 7 * 24 * time.Hour},
+	RANK_ENGAGING: &EngagementRanker{Prior: 20},
+}
+
+// GetRanker returns the named ranker falling back to wilson.
+func GetRanker(name string) Ranker {
+	if r, ok := Rankers[name]; ok {
+		return r
+	}
+	return Rankers[RANK_WILSON]
+}
+
+// ContestRanking tells if a contest can be ranked by the named ranking.
+func ContestRanking(name string) bool {
+	for _, r := range CONTEST_RANKINGS {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+func scoreOf(votes []*Vote) *Score {
+	s := &Score{Hist: make([]float64, 5)}
+	for _, v := range votes {
+		s.Count++
+		s.Sum += v.Score * v.Weight()
+		s.Hist[int(v.Score)-1] += v.Weight()
+	}
+	return s
+}
+
+// WilsonRanker uses the lower bound of the wilson score interval
+// http://www.goproblems.com/test/wilson/wilson-new.php
+type WilsonRanker struct {
+	Z      float64 // normal distribution quantile for the confidence level
+	Levels int     // number of possible votes
+}
+
+func (r *WilsonRanker) Rank(votes []*Vote, now time.Time) float64 {
+	return r.RankScore(scoreOf(votes))
+}
+
+func (r *WilsonRanker) RankScore(s *Score) float64 {
+	n := s.Total()
+	if n <= 0 {
+		return 0
+	}
+	k := float64(r.Levels - 1)
+	sum := 0.0
+	for i, w := range s.Hist {
+		sum += w * float64(i) / k
+	}
+	z := r.Z
+	avg := sum / n
+	lower := (avg + z*z/(2*n) - z*math.Sqrt((k*avg*(1-avg)+z*z/(4*n))/n)) / (1 + k*z*z/n)
+	return 1 + k*lower
+}
+
+func (r *WilsonRanker) Field() string {
+	return "score.wilson"
+}
+
+// BayesianRanker pulls the average towards the prior until the photo
+// has enough votes.
+type BayesianRanker struct {
+	Prior  float64 // average assumed without votes
+	Weight float64 // number of votes the prior is worth
+}
+
+func (r *BayesianRanker) Rank(votes []*Vote, now time.Time) float64 {
+	return r.RankScore(scoreOf(votes))
+}
+
+func (r *BayesianRanker) RankScore(s *Score) float64 {
+	return (r.Prior*r.Weight + s.Sum) / (r.Weight + s.Total())
+}
+
+func (r *BayesianRanker) Field() string {
+	return "score.bayes"
+}
+
+// TrendingRanker sums the positive votes halving their weight every
+// HalfLife, the votes older than Window are ignored.
+type TrendingRanker struct {
+	HalfLife time.Duration
+	Window   time.Duration
+}
+
+func (r *TrendingRanker) Rank(votes []*Vote, now time.Time) (rank float64) {
+	for _, v := range votes {
+		age := now.Sub(v.UpdatedOn)
+		if age > r.Window || v.Score <= NEUTRAL_HEARTS {
+			continue
+		}
+		if age < 0 {
+			age = 0
+		}
+		positive := (v.Score - NEUTRAL_HEARTS) / (5 - NEUTRAL_HEARTS)
+		rank += v.Weight() * positive * math.Pow(0.5, float64(age)/float64(r.HalfLife))
+	}
+	return
+}
+
+// EngagementRanker uses the share of the views that turned into positive
+// votes. The prior views keep the photos seen a few times from topping the
+// list with a single vote.
+type EngagementRanker struct {
+	Prior float64 // views added to every photo
+}
+
+// Rank has only the votes, the views are known to RankScore.
+func (r *EngagementRanker) Rank(votes []*Vote, now time.Time) float64 {
+	return r.RankScore(scoreOf(votes))
+}
+
+func (r *EngagementRanker) RankScore(s *Score) float64 {
+	positive := 0.0
+	for i, w := range s.Hist {
+		if i+1 > NEUTRAL_HEARTS {
+			positive += w
+		}
+	}
+	return positive / (float64(s.Views) + r.Prior)
+}
+
+func (r *EngagementRanker) Field() string {
+	return "score.engagement"
+}
+
+// Ranked is a photo with its rank in a listing.
+type Ranked struct {
+	Photo bson.ObjectId `bson:"_id"`
+	Votes []*Vote
+	Rank  float64
+	Count int `bson:"-"` // number of votes or duels
+}
+
+type rankedSorter []*Ranked
+
+func (r rankedSorter) Len() int           { return len(r) }
+func (r rankedSorter) Less(i, j int) bool { return r[i].Rank > r[j].Rank }
+func (r rankedSorter) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// RankVotes groups the votes matching the query by photo and returns the
+// photos ordered by the ranker. The query can use the photo demographics
+// copied on the votes.
+func RankVotes(ctx *Context, ranker Ranker, query bson.M) ([]*Ranked, error) {
+	now := time.Now()
+	match := bson.M{}
+	for k, v := range query {
+		match[k] = v
+	}
+	if t, ok := ranker.(*TrendingRanker); ok {
+		match["updatedon"] = bson.M{"$gt": now.Add(-t.Window)}
+	}
+	var ranked []*Ranked
+	err := ctx.C("votes").Pipe([]bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   "$photo",
+			"votes": bson.M{"$push": bson.M{"score": "$score", "updatedon": "$updatedon", "distrust": "$distrust"}},
+		}},
+	}).All(&ranked)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ranked {
+		r.Rank = ranker.Rank(r.Votes, now)
+		r.Count = len(r.Votes)
+	}
+	sort.Sort(rankedSorter(ranked))
+	return ranked, nil
+}
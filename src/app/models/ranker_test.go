@@ -0,0 +1,139 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func votes(scores ...float64) (result []*Vote) {
+	for _, s := range scores {
+		result = append(result, &Vote{Score: s})
+	}
+	return
+}
+
+func TestRankers(t *testing.T) {
+	wilson := &WilsonRanker{Z: 1.96, Levels: 5}
+	bayes := &BayesianRanker{Prior: 3, Weight: 10}
+	now := time.Now()
+	tests := []struct {
+		name   string
+		ranker Ranker
+		votes  []*Vote
+		want   float64
+	}{
+		{"wilson no votes", wilson, nil, 0},
+		{"wilson all ones", wilson, votes(1, 1, 1), 1},
+		{"wilson single five", wilson, votes(5), 1.2444},
+		{"bayes no votes", bayes, nil, 3},
+		{"bayes ten fives", bayes, votes(5, 5, 5, 5, 5, 5, 5, 5, 5, 5), 4},
+		{"bayes one vote", bayes, votes(1), 2.8182},
+		{"bayes distrusted vote", bayes, []*Vote{{Score: 1, Distrust: 1}}, 3},
+		{"wilson half trusted", wilson, []*Vote{{Score: 5, Distrust: 0.5}, {Score: 5, Distrust: 0.5}}, 1.2444},
+	}
+	for _, tt := range tests {
+		if got := tt.ranker.Rank(tt.votes, now); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("%s: got %.4f want %.4f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEngagementRanker(t *testing.T) {
+	engaging := &EngagementRanker{Prior: 20}
+	tests := []struct {
+		name  string
+		score *Score
+		want  float64
+	}{
+		{"no views no votes", &Score{}, 0},
+		{"positive votes only", &Score{Hist: []float64{1, 0, 1, 1, 2}, Views: 80}, 0.03},
+		{"unseen", &Score{Hist: []float64{0, 0, 0, 0, 2}}, 0.1},
+	}
+	for _, tt := range tests {
+		if got := engaging.RankScore(tt.score); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("%s: got %.4f want %.4f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWilsonOrder(t *testing.T) {
+	wilson := &WilsonRanker{Z: 1.96, Levels: 5}
+	now := time.Now()
+	tests := []struct {
+		name          string
+		better, worse []*Vote
+	}{
+		{"more votes", votes(5, 5, 5, 5, 5), votes(5)},
+		{"higher votes", votes(4, 4, 4), votes(3, 3, 3)},
+	}
+	for _, tt := range tests {
+		if wilson.Rank(tt.better, now) <= wilson.Rank(tt.worse, now) {
+			t.Errorf("%s: wrong order", tt.name)
+		}
+	}
+}
+
+func TestTrendingRanker(t *testing.T) {
+	trending := &TrendingRanker{HalfLife: time.Hour, Window: 24 * time.Hour}
+	now := time.Now()
+	at := func(score float64, ago time.Duration) *Vote {
+		return &Vote{Score: score, UpdatedOn: now.Add(-ago)}
+	}
+	tests := []struct {
+		name  string
+		votes []*Vote
+		want  float64
+	}{
+		{"no votes", nil, 0},
+		{"fresh five", []*Vote{at(5, 0)}, 1},
+		{"half life", []*Vote{at(5, time.Hour)}, 0.5},
+		{"two half lives", []*Vote{at(5, 2*time.Hour)}, 0.25},
+		{"outside window", []*Vote{at(5, 25*time.Hour)}, 0},
+		{"future vote", []*Vote{at(5, -time.Hour)}, 1},
+		{"sum", []*Vote{at(5, 0), at(5, time.Hour)}, 1.5},
+		{"four", []*Vote{at(4, 0)}, 0.5},
+		{"neutral and negative", []*Vote{at(3, 0), at(1, 0)}, 0},
+	}
+	for _, tt := range tests {
+		if got := trending.Rank(tt.votes, now); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("%s: got %.4f want %.4f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetRanker(t *testing.T) {
+	tests := []struct {
+		name string
+		want Ranker
+	}{
+		{RANK_WILSON, Rankers[RANK_WILSON]},
+		{RANK_BAYES, Rankers[RANK_BAYES]},
+		{RANK_TRENDING, Rankers[RANK_TRENDING]},
+		{"", Rankers[RANK_WILSON]},
+		{"unknown", Rankers[RANK_WILSON]},
+	}
+	for _, tt := range tests {
+		if got := GetRanker(tt.name); got != tt.want {
+			t.Errorf("GetRanker(%q) = %v", tt.name, got)
+		}
+	}
+}
+
+func TestEloUpdate(t *testing.T) {
+	tests := []struct {
+		name                  string
+		winner, loser         float64
+		wantWinner, wantLoser float64
+	}{
+		{"equal", 1500, 1500, 1516, 1484},
+		{"favourite", 1600, 1400, 1607.6880, 1392.3120},
+		{"upset", 1400, 1600, 1424.3120, 1575.6880},
+	}
+	for _, tt := range tests {
+		w, l := EloUpdate(tt.winner, tt.loser)
+		if math.Abs(w-tt.wantWinner) > 0.001 || math.Abs(l-tt.wantLoser) > 0.001 {
+			t.Errorf("%s: got %.4f %.4f want %.4f %.4f", tt.name, w, l, tt.wantWinner, tt.wantLoser)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"fmt"
+	"labix.org/v2/mgo/bson"
+	"sort"
+)
+
+const (
+	BY_COUNTRY = "country"
+	BY_AGE     = "age"
+	BY_GENDER  = "gender"
+)
+
+type AgeBand struct {
+	Name     string
+	Min, Max int // zero Max means no upper limit
+}
+
+var AGE_BANDS = []AgeBand{
+	{"18-24", 18, 24},
+	{"25-34", 25, 34},
+	{"35-44", 35, 44},
+	{"45-54", 45, 54},
+	{"55+", 55, 0},
+}
+
+func (b AgeBand) Filter() *Filter {
+	return &Filter{MinAge: b.Min, MaxAge: b.Max}
+}
+
+func (b AgeBand) Contains(age int) bool {
+	return age >= b.Min && (b.Max == 0 || age <= b.Max)
+}
+
+func AgeBandOf(age int) string {
+	for _, b := range AGE_BANDS {
+		if b.Contains(age) {
+			return b.Name
+		}
+	}
+	return ""
+}
+
+// Group is a named list of top photos in a demographic breakdown.
+type Group struct {
+	Name   string
+	Photos []*Photo
+}
+
+// TopPhotosBy returns the best ranked photos matching the query for every
+// country, age band or gender.
+func TopPhotosBy(ctx *Context, by string, match bson.M, limit int) (groups []*Group, err error) {
+	var names []string
+	queries := make(map[string]bson.M)
+	switch by {
+	case BY_COUNTRY, BY_GENDER:
+		if err = ctx.C("photos").Find(match).Distinct(by, &names); err != nil {
+			return
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			queries[n] = bson.M{by: n}
+		}
+	case BY_AGE:
+		for _, b := range AGE_BANDS {
+			q := bson.M{}
+			b.Filter().AddQuery(q)
+			names = append(names, b.Name)
+			queries[b.Name] = q
+		}
+	default:
+		return nil, fmt.Errorf("unknown breakdown: %s", by)
+	}
+	for _, n := range names {
+		if n == "" {
+			continue
+		}
+		g := &Group{Name: n}
+		query := bson.M{"$and": []bson.M{match, queries[n]}}
+		if err = ctx.C("photos").Find(query).Sort("-score.wilson").Limit(limit).All(&g.Photos); err != nil {
+			return
+		}
+		if len(g.Photos) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return
+}
+
+type Rating struct {
+	Name  string
+	Count int
+	Sum   float64
+}
+
+func (r *Rating) Avg() float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return r.Sum / float64(r.Count)
+}
+
+type Ratings []*Rating
+
+func (r Ratings) add(name string, score float64) Ratings {
+	if name == "" {
+		name = "unknown"
+	}
+	for _, x := range r {
+		if x.Name == name {
+			x.Count++
+			x.Sum += score
+			return r
+		}
+	}
+	return append(r, &Rating{Name: name, Count: 1, Sum: score})
+}
+
+func (r Ratings) Len() int           { return len(r) }
+func (r Ratings) Less(i, j int) bool { return r[i].Count > r[j].Count }
+func (r Ratings) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// RatingBreakdown shows how the voters of each demographic rated a photo.
+type RatingBreakdown struct {
+	Country, Age, Gender Ratings
+}
+
+// PhotoRatingBreakdown groups the votes of the photo by the voters
+// demographics copied on the votes.
+func PhotoRatingBreakdown(ctx *Context, photo bson.ObjectId) (*RatingBreakdown, error) {
+	var votes []*Vote
+	if err := ctx.C("votes").Find(bson.M{"photo": photo}).Select(bson.M{"voter": 1, "score": 1}).All(&votes); err != nil {
+		return nil, err
+	}
+	b := &RatingBreakdown{}
+	for _, v := range votes {
+		b.Country = b.Country.add(v.Voter.Country, v.Score)
+		b.Age = b.Age.add(AgeBandOf(v.Voter.Age), v.Score)
+		b.Gender = b.Gender.add(v.Voter.Gender, v.Score)
+	}
+	sort.Sort(b.Country)
+	sort.Sort(b.Age)
+	sort.Sort(b.Gender)
+	return b, nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"fmt"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+const PODIUM_SIZE = 3
+
+// Result is the final placement of an entry, frozen when the contest closes.
+type Result struct {
+	Place    int
+	Photo    bson.ObjectId
+	User     bson.ObjectId
+	UserName string
+	Title    string
+	Rank     float64
+	Count    int // number of votes or duels
+}
+
+// Finished tells if the voting is over.
+func (c *Contest) Finished() bool {
+	return c.State == STATE_CLOSED || c.State == STATE_RESULTS
+}
+
+// Closed tells if the results were computed.
+func (c *Contest) Closed() bool {
+	return !c.ClosedOn.IsZero()
+}
+
+// Podium returns the best placed entries.
+func (c *Contest) Podium() []*Result {
+	var podium []*Result
+	for _, r := range c.Results {
+		if r.Place > PODIUM_SIZE {
+			break
+		}
+		podium = append(podium, r)
+	}
+	return podium
+}
+
+// FinalStandings places all the approved entries by the contest ranking.
+func (c *Contest) FinalStandings(ctx *Context) ([]*Result, error) {
+	standings, err := c.Standings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return placeEntries(c.Registered, standings), nil
+}
+
+// placeEntries places the approved entries in the order of the standings.
+// Entries with equal ranks share the place, the ones without votes come
+// last.
+func placeEntries(registered []*RegItem, standings []*Ranked) []*Result {
+	entries := make(map[bson.ObjectId]*RegItem)
+	for _, ri := range registered {
+		if ri.Approved {
+			entries[ri.Photo] = ri
+		}
+	}
+	var results []*Result
+	for _, s := range standings {
+		ri, ok := entries[s.Photo]
+		if !ok {
+			continue
+		}
+		results = append(results, &Result{
+			Photo:    ri.Photo,
+			User:     ri.User,
+			UserName: ri.UserName,
+			Title:    ri.Title,
+			Rank:     s.Rank,
+			Count:    s.Count,
+		})
+		delete(entries, s.Photo)
+	}
+	for _, ri := range registered {
+		if _, ok := entries[ri.Photo]; ok {
+			results = append(results, &Result{Photo: ri.Photo, User: ri.User, UserName: ri.UserName, Title: ri.Title})
+		}
+	}
+	for i, r := range results {
+		r.Place = i + 1
+		if i > 0 && r.Rank == results[i-1].Rank {
+			r.Place = results[i-1].Place
+		}
+	}
+	return results
+}
+
+// CloseContest freezes the final standings in the contest and, when
+// notify is set, tells every participant their placement. A contest is
+// closed only once.
+func CloseContest(ctx *Context, c *Contest, notify bool) error {
+	if c.Closed() || !c.Finished() {
+		return nil
+	}
+	results, err := c.FinalStandings(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = ctx.C("contests").Update(bson.M{"_id": c.Id, "closedon": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"results": results, "closedon": now}})
+	if err == mgo.ErrNotFound {
+		return nil // closed meanwhile
+	}
+	if err != nil {
+		return err
+	}
+	c.Results, c.ClosedOn = results, now
+	publishContest(c, "results", map[string]string{"id": c.Id.Hex(), "name": c.Name})
+	if notify {
+		notifyResults(ctx, c)
+	}
+	return nil
+}
+
+func notifyResults(ctx *Context, c *Contest) {
+	for _, r := range c.Results {
+		body := fmt.Sprintf("The contest %s is over. Your photo %s placed #%d of %d.", c.Name, r.Title, r.Place, len(c.Results))
+		if err := notifyContest(ctx, c, r.User, fmt.Sprintf("#%d", r.Place), body); err != nil {
+			Log("error notifying results: ", err.Error())
+			continue
+		}
+		Publish(UserTopic(r.User), "contest_result", map[string]interface{}{
+			"id":    c.Id.Hex(),
+			"name":  c.Name,
+			"place": r.Place,
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"strconv"
+	"testing"
+)
+
+func TestPlaceEntries(t *testing.T) {
+	a, b, c, d := bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()
+	registered := []*RegItem{
+		{Photo: a, Title: "a", Approved: true},
+		{Photo: b, Title: "b", Approved: true},
+		{Photo: c, Title: "c", Approved: true},
+		{Photo: d, Title: "d"}, // not approved
+	}
+	tests := []struct {
+		name      string
+		standings []*Ranked
+		want      string // titles with places
+	}{
+		{"distinct ranks", []*Ranked{{Photo: c, Rank: 3}, {Photo: a, Rank: 2}, {Photo: b, Rank: 1}}, "1c 2a 3b"},
+		{"tie on top", []*Ranked{{Photo: b, Rank: 3}, {Photo: a, Rank: 3}, {Photo: c, Rank: 1}}, "1b 1a 3c"},
+		{"tie below", []*Ranked{{Photo: b, Rank: 3}, {Photo: a, Rank: 2}, {Photo: c, Rank: 2}}, "1b 2a 2c"},
+		{"all tied", []*Ranked{{Photo: a, Rank: 1}, {Photo: b, Rank: 1}, {Photo: c, Rank: 1}}, "1a 1b 1c"},
+		{"unvoted last", []*Ranked{{Photo: b, Rank: 4}}, "1b 2a 2c"},
+		{"no votes", nil, "1a 1b 1c"},
+		{"unapproved skipped", []*Ranked{{Photo: d, Rank: 5}, {Photo: a, Rank: 1}}, "1a 2b 2c"},
+	}
+	for _, tt := range tests {
+		got := ""
+		for i, r := range placeEntries(registered, tt.standings) {
+			if i > 0 {
+				got += " "
+			}
+			got += strconv.Itoa(r.Place) + r.Title
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"fmt"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+// Score holds the vote aggregates of a photo, kept up to date on every vote
+// so the top lists can be sorted and paginated by the database. The votes
+// are weighted by the trust in their voters.
+type Score struct {
+	Count      int
+	Sum        float64   // weighted sum of the votes
+	Hist       []float64 // weighted number of votes for each heart count
+	Wilson     float64
+	Bayes      float64
+	Engagement float64 // positive votes per view
+	Views      int
+}
+
+// Total returns the weighted number of votes.
+func (s *Score) Total() (total float64) {
+	for _, w := range s.Hist {
+		total += w
+	}
+	return
+}
+
+func (s *Score) Avg() float64 {
+	total := s.Total()
+	if total <= 0 {
+		return 0
+	}
+	return s.Sum / total
+}
+
+// Conversion is the share of the views that turned into votes.
+func (s *Score) Conversion() float64 {
+	if s.Views == 0 {
+		return 0
+	}
+	return float64(s.Count) / float64(s.Views)
+}
+
+// Rank updates the stored ranks from the totals.
+func (s *Score) Rank() {
+	s.Wilson = Rankers[RANK_WILSON].(ScoreRanker).RankScore(s)
+	s.Bayes = Rankers[RANK_BAYES].(ScoreRanker).RankScore(s)
+	s.Engagement = Rankers[RANK_ENGAGING].(ScoreRanker).RankScore(s)
+}
+
+func histKey(score float64) string {
+	return fmt.Sprintf("score.hist.%d", int(score)-1)
+}
+
+// ScoreVote updates the aggregates of the photo with a new vote (old has
+// zero score) or with a changed one.
+func ScoreVote(ctx *Context, old, v *Vote) error {
+	if old.Score == v.Score && old.Weight() == v.Weight() {
+		return nil
+	}
+	// the histogram must be an array before incrementing its elements
+	err := ctx.C("photos").Update(bson.M{"_id": v.Photo, "score.hist": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"score.hist": make([]float64, 5)}})
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	inc := bson.M{
+		"score.sum":      v.Score * v.Weight(),
+		histKey(v.Score): v.Weight(),
+	}
+	if old.Score == 0 {
+		inc["score.count"] = 1
+	} else {
+		inc["score.sum"] = v.Score*v.Weight() - old.Score*old.Weight()
+		if old.Score == v.Score {
+			inc[histKey(v.Score)] = v.Weight() - old.Weight()
+		} else {
+			inc[histKey(old.Score)] = -old.Weight()
+		}
+	}
+	return updateScore(ctx.Database, v.Photo, bson.M{"$inc": inc})
+}
+
+// UnscoreVote removes a retracted vote from the aggregates.
+func UnscoreVote(ctx *Context, old *Vote) error {
+	return updateScore(ctx.Database, old.Photo, bson.M{"$inc": bson.M{
+		"score.count":      -1,
+		"score.sum":        -old.Score * old.Weight(),
+		histKey(old.Score): -old.Weight(),
+	}})
+}
+
+func updateScore(db *mgo.Database, photo bson.ObjectId, update bson.M) error {
+	p := &Photo{}
+	change := mgo.Change{Update: update, ReturnNew: true}
+	if _, err := db.C("photos").FindId(photo).Select(bson.M{"score": 1}).Apply(change, p); err != nil {
+		return err
+	}
+	p.Score.Rank()
+	return db.C("photos").UpdateId(photo, bson.M{"$set": bson.M{
+		"score.wilson":     p.Score.Wilson,
+		"score.bayes":      p.Score.Bayes,
+		"score.engagement": p.Score.Engagement,
+	}})
+}
+
+// unsetVotes clears the vote aggregates keeping the views.
+var unsetVotes = bson.M{"$unset": bson.M{
+	"score.count":      1,
+	"score.sum":        1,
+	"score.hist":       1,
+	"score.wilson":     1,
+	"score.bayes":      1,
+	"score.engagement": 1,
+}}
+
+// RebuildScores recomputes the aggregates of all the photos from the votes.
+func RebuildScores() error {
+	db := db_session.Clone().DB(database)
+	defer db.Session.Close()
+	if _, err := db.C("photos").UpdateAll(nil, unsetVotes); err != nil {
+		return err
+	}
+	return rebuildScores(db, bson.M{})
+}
+
+// rescorePhotos recomputes the aggregates of the given photos.
+func rescorePhotos(db *mgo.Database, photos []bson.ObjectId) error {
+	if len(photos) == 0 {
+		return nil
+	}
+	if _, err := db.C("photos").UpdateAll(bson.M{"_id": bson.M{"$in": photos}}, unsetVotes); err != nil {
+		return err
+	}
+	return rebuildScores(db, bson.M{"photo": bson.M{"$in": photos}})
+}
+
+func rebuildScores(db *mgo.Database, match bson.M) error {
+	var r struct {
+		Photo bson.ObjectId `bson:"_id"`
+		Votes []*Vote
+	}
+	var p Photo
+	iter := db.C("votes").Pipe([]bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": "$photo", "votes": bson.M{"$push": bson.M{"score": "$score", "distrust": "$distrust"}}}},
+	}).Iter()
+	for iter.Next(&r) {
+		s := scoreOf(r.Votes)
+		// the engagement also needs the views kept on the photo
+		p = Photo{}
+		if err := db.C("photos").FindId(r.Photo).Select(bson.M{"score.views": 1}).One(&p); err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		s.Views = p.Score.Views
+		s.Rank()
+		if err := db.C("photos").UpdateId(r.Photo, bson.M{"$set": bson.M{
+			"score.count":      s.Count,
+			"score.sum":        s.Sum,
+			"score.hist":       s.Hist,
+			"score.wilson":     s.Wilson,
+			"score.bayes":      s.Bayes,
+			"score.engagement": s.Engagement,
+		}}); err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		r.Votes = nil
+	}
+	return iter.Close()
+}
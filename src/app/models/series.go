@@ -0,0 +1,222 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// recurrence rules of the contest series
+const (
+	RECUR_WEEKLY  = "weekly"
+	RECUR_MONTHLY = "monthly"
+)
+
+// Series publishes a new contest from its template at every recurrence.
+// The deadlines of the instances keep the windows of the template contest.
+// The recurrences are anchored on the first start in the organizer's
+// timezone, so they keep the day and the wall clock time.
+type Series struct {
+	Id            bson.ObjectId `bson:"_id,omitempty"`
+	User          bson.ObjectId
+	Name          string
+	Recurrence    string
+	Template      *Contest
+	AdmissionDays int
+	VotingDays    int
+	Count         int       // instances created so far
+	Start         time.Time // start of the first instance
+	Timezone      string    // of the organizer
+	Next          time.Time // when the next instance starts
+	Stopped       bool
+	CreatedOn     time.Time
+}
+
+func (s *Series) location() *time.Location {
+	if loc, err := LoadTimezone(s.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// period returns the start of the k-th recurrence, the first instance
+// being the 0th. The monthly ones fall on the last day of the shorter
+// months.
+func (s *Series) period(k int) time.Time {
+	t := s.Start.In(s.location())
+	year, month, day := t.Date()
+	if s.Recurrence == RECUR_MONTHLY {
+		month += time.Month(k)
+		if last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day(); day > last {
+			day = last
+		}
+	} else {
+		day += 7 * k
+	}
+	return time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location()).UTC()
+}
+
+// due returns the start of the latest recurrence by now and of the one
+// following it.
+func (s *Series) due(now time.Time) (current, next time.Time) {
+	k := 0
+	for !s.period(k + 1).After(now) {
+		k++
+	}
+	return s.period(k), s.period(k + 1)
+}
+
+// windowDays rounds the duration up to whole days, at least one.
+func windowDays(d time.Duration) int {
+	days := int((d + 24*time.Hour - 1) / (24 * time.Hour))
+	if days < 1 {
+		return 1
+	}
+	return days
+}
+
+// NewSeries makes the contest the first instance of a series repeating by
+// the recurrence rule.
+func NewSeries(ctx *Context, c *Contest, recurrence string) (*Series, error) {
+	if recurrence != RECUR_WEEKLY && recurrence != RECUR_MONTHLY {
+		return nil, errors.New("Unknown recurrence")
+	}
+	if c.Series != "" {
+		return nil, errors.New("The contest is already recurring")
+	}
+	now := time.Now()
+	start := now
+	if c.Public {
+		start = c.Id.Time()
+	}
+	s := &Series{
+		Id:            bson.NewObjectId(),
+		User:          c.User,
+		Name:          c.Name,
+		Recurrence:    recurrence,
+		Template:      c.template(),
+		AdmissionDays: windowDays(c.AdmissionDeadline.Sub(start)),
+		VotingDays:    windowDays(c.VotingDeadline.Sub(c.AdmissionDeadline)),
+		Count:         1,
+		Start:         start,
+		Timezone:      ctx.Location().String(),
+		CreatedOn:     now,
+	}
+	_, s.Next = s.due(now)
+	if err := ctx.C("contests").Update(bson.M{"_id": c.Id, "series": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"series": s.Id, "seriesnumber": 1}}); err != nil {
+		return nil, err
+	}
+	return s, ctx.C("series").Insert(s)
+}
+
+// StopSeries stops creating new instances, the existing ones run to the end.
+func StopSeries(ctx *Context, id, user bson.ObjectId) error {
+	return ctx.C("series").Update(bson.M{"_id": id, "user": user}, bson.M{"$set": bson.M{"stopped": true}})
+}
+
+// SetTemplate makes the draft contest the template of the next instances
+// of the series. The draft is edited with the usual contest form.
+func SetTemplate(ctx *Context, id, user bson.ObjectId, draft *Contest) error {
+	if draft.Public || draft.User != user {
+		return errors.New("Only your drafts can be templates")
+	}
+	return ctx.C("series").Update(bson.M{"_id": id, "user": user}, bson.M{"$set": bson.M{
+		"template":      draft.template(),
+		"admissiondays": windowDays(draft.AdmissionDeadline.Sub(time.Now())),
+		"votingdays":    windowDays(draft.VotingDeadline.Sub(draft.AdmissionDeadline)),
+	}})
+}
+
+// template copies the settings carried over to the instances.
+func (c *Contest) template() *Contest {
+	t := *c
+	t.Id = ""
+	t.Registered = nil
+	t.CommentCount = 0
+	t.Results = nil
+	t.ClosedOn = time.Time{}
+	t.State = ""
+	t.NextTransition = time.Time{}
+	t.Series = ""
+	t.SeriesNumber = 0
+	t.InviteCode = ""
+	return &t
+}
+
+// instance returns the n-th contest of the series starting at start,
+// published right away.
+func (s *Series) instance(n int, start time.Time) *Contest {
+	c := *s.Template
+	c.Id = bson.NewObjectId()
+	c.Name = fmt.Sprintf("%s #%d", s.Name, n)
+	c.Registered = []*RegItem{}
+	local := start.In(s.location())
+	c.AdmissionDeadline = local.AddDate(0, 0, s.AdmissionDays).UTC()
+	c.VotingDeadline = local.AddDate(0, 0, s.AdmissionDays+s.VotingDays).UTC()
+	c.Public = true
+	c.State = STATE_PUBLISHED
+	c.NextTransition = start
+	c.Series = s.Id
+	c.SeriesNumber = n
+	if c.InviteOnly() {
+		c.InviteCode = NewInviteCode()
+	}
+	return &c
+}
+
+// advanceSeries creates the instances due by now. After a downtime only the
+// current recurrence gets an instance, the missed ones are skipped. Moving
+// the next start first keeps the other processes from creating the same
+// instance.
+func advanceSeries(ctx *Context, now time.Time) error {
+	var series []*Series
+	if err := ctx.C("series").Find(bson.M{"next": bson.M{"$lte": now}, "stopped": false}).All(&series); err != nil {
+		return err
+	}
+	for _, s := range series {
+		if s.Start.IsZero() { // created before the anchoring
+			s.Start = s.Next
+		}
+		start, next := s.due(now)
+		n := s.Count + 1
+		err := ctx.C("series").Update(bson.M{"_id": s.Id, "next": s.Next},
+			bson.M{"$set": bson.M{"next": next, "count": n, "start": s.Start}})
+		if err == mgo.ErrNotFound {
+			continue // created by another process
+		}
+		if err != nil {
+			return err
+		}
+		c := s.instance(n, start)
+		if err := ctx.C("contests").Insert(c); err != nil {
+			return err
+		}
+		publishContest(c, "contest", map[string]string{"id": c.Id.Hex(), "name": c.Name, "phase": c.State})
+	}
+	return nil
+}
+
+// SeriesContests returns the instances of the series, the latest first.
+func SeriesContests(ctx *Context, series bson.ObjectId) (contests []*Contest, err error) {
+	err = ctx.C("contests").Find(bson.M{"series": series}).Sort("-seriesnumber").All(&contests)
+	return
+}
+
+// Winner returns the first placed entry of a closed contest.
+func (c *Contest) Winner() *Result {
+	if len(c.Results) == 0 {
+		return nil
+	}
+	return c.Results[0]
+}
+
+func ensureSeriesIndexes(db *mgo.Database) {
+	if err := db.C("series").EnsureIndexKey("next"); err != nil {
+		Log("series index: ", err.Error())
+	}
+	if err := db.C("contests").EnsureIndexKey("series", "-seriesnumber"); err != nil {
+		Log("contests index: ", err.Error())
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"testing"
+	"time"
+)
+
+func TestSeriesInstance(t *testing.T) {
+	juror := &Member{Id: bson.NewObjectId()}
+	c := &Contest{
+		Id:             bson.NewObjectId(),
+		Name:           "Smile",
+		Country:        "Romania",
+		MaxEntries:     3,
+		MinAccountDays: 7,
+		Jurors:         []*Member{juror},
+		Registered:     []*RegItem{{User: bson.NewObjectId()}},
+		Results:        []*Result{{Place: 1}},
+		State:          STATE_RESULTS,
+	}
+	s := &Series{Id: bson.NewObjectId(), Name: c.Name, Recurrence: RECUR_WEEKLY, Template: c.template(), AdmissionDays: 5, VotingDays: 2}
+	start := time.Date(2013, 3, 4, 10, 0, 0, 0, time.UTC)
+	i := s.instance(4, start)
+	if i.Name != "Smile #4" || i.Series != s.Id || i.SeriesNumber != 4 {
+		t.Errorf("wrong identity: %s %v %d", i.Name, i.Series, i.SeriesNumber)
+	}
+	if !i.AdmissionDeadline.Equal(start.AddDate(0, 0, 5)) || !i.VotingDeadline.Equal(start.AddDate(0, 0, 7)) {
+		t.Errorf("wrong deadlines: %v %v", i.AdmissionDeadline, i.VotingDeadline)
+	}
+	if i.Country != "Romania" || i.MaxEntries != 3 || i.MinAccountDays != 7 || !i.IsJuror(juror.Id) {
+		t.Errorf("settings not carried over: %+v", i)
+	}
+	if len(i.Registered) != 0 || i.Results != nil || i.State != STATE_PUBLISHED || !i.Public || i.Id == c.Id {
+		t.Errorf("instance not fresh: %+v", i)
+	}
+}
+
+func TestSeriesPeriods(t *testing.T) {
+	bucharest, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Skip("no timezone database: ", err)
+	}
+	local := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2013, month, day, hour, 0, 0, 0, bucharest).UTC()
+	}
+	monthly := &Series{Recurrence: RECUR_MONTHLY, Start: local(1, 31, 10), Timezone: "Europe/Bucharest"}
+	// the summer time starts on March 31st
+	weekly := &Series{Recurrence: RECUR_WEEKLY, Start: local(3, 25, 10), Timezone: "Europe/Bucharest"}
+	tests := []struct {
+		name   string
+		series *Series
+		k      int
+		want   time.Time
+	}{
+		{"monthly first", monthly, 0, local(1, 31, 10)},
+		{"monthly short month", monthly, 1, local(2, 28, 10)},
+		{"monthly back to the anchor", monthly, 2, local(3, 31, 10)},
+		{"monthly thirty days", monthly, 3, local(4, 30, 10)},
+		{"weekly over the time change", weekly, 1, local(4, 1, 10)},
+	}
+	for _, tt := range tests {
+		if got := tt.series.period(tt.k); !got.Equal(tt.want) {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+	// after a downtime only the latest recurrence is due
+	current, next := weekly.due(local(4, 16, 12))
+	if !current.Equal(local(4, 15, 10)) || !next.Equal(local(4, 22, 10)) {
+		t.Errorf("due: got %v %v", current, next)
+	}
+}
+
+func TestWindowDays(t *testing.T) {
+	for d, want := range map[time.Duration]int{0: 1, time.Hour: 1, 24 * time.Hour: 1, 25 * time.Hour: 2, -time.Hour: 1} {
+		if got := windowDays(d); got != want {
+			t.Errorf("%v: got %d want %d", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+// SyncAuthor propagates the name, avatar and info of the user to all the
+// copies made at write time in comments, messages, contest registrations
+// and contest member lists.
+func SyncAuthor(id bson.ObjectId) error {
+	db := db_session.Clone().DB(database)
+	defer db.Session.Close()
+	u := &User{}
+	if err := db.C("users").FindId(id).One(u); err != nil {
+		return err
+	}
+	return syncAuthor(db, u)
+}
+
+func syncAuthor(db *mgo.Database, u *User) error {
+	name, info := u.FullName(), u.Info()
+	author := bson.M{"username": name, "avatar": u.Avatar}
+	if _, err := db.C("comments").UpdateAll(bson.M{"user": u.Id}, bson.M{"$set": author}); err != nil {
+		return err
+	}
+	// the notifications sent by a contest keep the contest name
+	if _, err := db.C("messages").UpdateAll(bson.M{"from": u.Id, "contest": bson.M{"$exists": false}}, bson.M{"$set": author}); err != nil {
+		return err
+	}
+	// the positional operator only reaches the first stale registration of
+	// a contest so the update is repeated until none is left
+	stale := bson.M{"registered": bson.M{"$elemMatch": bson.M{
+		"user": u.Id,
+		"$or":  []bson.M{{"username": bson.M{"$ne": name}}, {"userinfo": bson.M{"$ne": info}}},
+	}}}
+	for {
+		change, err := db.C("contests").UpdateAll(stale, bson.M{"$set": bson.M{"registered.$.username": name, "registered.$.userinfo": info}})
+		if err != nil {
+			return err
+		}
+		if change.Updated == 0 {
+			break
+		}
+	}
+	// a user is listed at most once in every member list
+	for _, members := range []string{"jurors", "organizers", "invited"} {
+		stale := bson.M{members: bson.M{"$elemMatch": bson.M{"_id": u.Id, "name": bson.M{"$ne": name}}}}
+		if _, err := db.C("contests").UpdateAll(stale, bson.M{"$set": bson.M{members + ".$.name": name}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepairAuthors rebuilds the denormalized author data for all the users.
+func RepairAuthors() error {
+	db := db_session.Clone().DB(database)
+	defer db.Session.Close()
+	var u User
+	iter := db.C("users").Find(nil).Select(bson.M{"password": 0}).Iter()
+	for iter.Next(&u) {
+		if err := syncAuthor(db, &u); err != nil {
+			return err
+		}
+		u = User{}
+	}
+	return iter.Close()
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	DEADLINE_DATE   = "2006-01-02"
+	DEADLINE_TIME   = "15:04"
+	DEADLINE_FORMAT = "02 Jan 2006 15:04 MST"
+)
+
+// LoadTimezone returns the location of an IANA timezone name. The server
+// local zone is refused as it means nothing to the users.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.New("Unknown timezone")
+	}
+	return time.LoadLocation(name)
+}
+
+// Location returns the timezone of the user, the one detected by the
+// browser for the anonymous users and UTC when unknown.
+func (c *Context) Location() *time.Location {
+	name := ""
+	if c.User != nil && c.User.Timezone != "" {
+		name = c.User.Timezone
+	} else if c.Session != nil {
+		name, _ = c.Session.Values["timezone"].(string)
+	}
+	if loc, err := LoadTimezone(name); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// ParseDeadline reads the date and the optional time of a deadline in the
+// organizer's timezone and returns it in UTC. A date without time means the
+// end of that day.
+func ParseDeadline(date, clock string, loc *time.Location) (time.Time, error) {
+	date, clock = strings.TrimSpace(date), strings.TrimSpace(clock)
+	if clock == "" {
+		clock = "23:59"
+	}
+	t, err := time.ParseInLocation(DEADLINE_DATE+" "+DEADLINE_TIME, date+" "+clock, loc)
+	if err != nil {
+		return time.Time{}, errors.New("Please use the yyyy-mm-dd date and hh:mm time")
+	}
+	return t.UTC(), nil
+}
+
+// LocalTime formats the time in the timezone of the viewer.
+func LocalTime(t time.Time, ctx *Context) string {
+	return t.In(ctx.Location()).Format(DEADLINE_FORMAT)
+}
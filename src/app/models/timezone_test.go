@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeadline(t *testing.T) {
+	bucharest, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Skip("no timezone database: ", err)
+	}
+	got, err := ParseDeadline("2013-03-04", "18:30", bucharest)
+	if err != nil || !got.Equal(time.Date(2013, 3, 4, 16, 30, 0, 0, time.UTC)) || got.Location() != time.UTC {
+		t.Errorf("with time: got %v %v", got, err)
+	}
+	got, err = ParseDeadline(" 2013-03-04 ", "", time.UTC)
+	if err != nil || !got.Equal(time.Date(2013, 3, 4, 23, 59, 0, 0, time.UTC)) {
+		t.Errorf("end of day: got %v %v", got, err)
+	}
+	if _, err := ParseDeadline("04/03/2013", "", time.UTC); err == nil {
+		t.Error("expected an error for a bad date")
+	}
+	if _, err := LoadTimezone("Local"); err == nil {
+		t.Error("expected the server zone to be refused")
+	}
+}
@@ -9,21 +9,35 @@ import (
 )
 
 type User struct {
-	Id        bson.ObjectId `bson:"_id,omitempty"`
-	Email     string
-	Password  []byte
-	FirstName string
-	LastName  string
-	Country   string
-	Location  string
-	BirthDate time.Time
-	Gender    string
-	Avatar    string `bson:"avatar,omitempty"`
-	FbId      string
-	GlId      string
-	Admin     bool `bson:"admin,omitempty"`
+	Id             bson.ObjectId `bson:"_id,omitempty"`
+	Email          string
+	Password       []byte
+	FirstName      string
+	LastName       string
+	Country        string
+	Location       string
+	BirthDate      time.Time
+	Gender         string
+	Avatar         string `bson:"avatar,omitempty"`
+	FbId           string
+	GlId           string
+	Admin          bool            `bson:"admin,omitempty"`
+	Blocked        []bson.ObjectId `bson:"blocked,omitempty"`
+	MessagePrivacy string          `bson:"messageprivacy,omitempty"`
+	Flags          []string        `bson:"flags,omitempty"`
+	Distrust       float64         `bson:"distrust,omitempty"`
+	Vetted         bool            `bson:"vetted,omitempty"`
+	Filters        []*Filter       `bson:"filters,omitempty"`
+	Timezone       string          `bson:"timezone,omitempty"`
 }
 
+// who can send private messages to a user
+const (
+	MSG_EVERYONE = ""
+	MSG_VOTED    = "voted"
+	MSG_NOBODY   = "nobody"
+)
+
 type PasswordToken struct {
 	Uuid      string `bson:"_id,omitempty"`
 	User      bson.ObjectId
@@ -60,6 +74,39 @@ func (u *User) Info() string {
 	return fmt.Sprintf("%s %d, %s - %s", u.Sex(), u.Age(), u.Location, u.Country)
 }
 
+// HasBlocked reports whether the user has the given user id on the block list.
+func (u *User) HasBlocked(id bson.ObjectId) bool {
+	for _, b := range u.Blocked {
+		if b == id {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsMessagesFrom checks the block list and the message privacy settings
+// of the user against the sender.
+func (u *User) AcceptsMessagesFrom(ctx *Context, from bson.ObjectId) bool {
+	if u.Id == from || u.HasBlocked(from) {
+		return false
+	}
+	switch u.MessagePrivacy {
+	case MSG_NOBODY:
+		return false
+	case MSG_VOTED:
+		// only people the user has voted for
+		c, err := ctx.C("votes").Find(bson.M{"user": u.Id, "photouser": from}).Limit(1).Count()
+		return err == nil && c != 0
+	}
+	return true
+}
+
+// IsBlocked reports whether the owner has blocked the user.
+func IsBlocked(ctx *Context, owner, user bson.ObjectId) bool {
+	c, err := ctx.C("users").Find(bson.M{"_id": owner, "blocked": user}).Limit(1).Count()
+	return err == nil && c != 0
+}
+
 //Login validates and returns a user object if they exist in the database.
 func Login(ctx *Context, email, password string) (u *User, err error) {
 	err = ctx.C("users").Find(bson.M{"email": email}).One(&u)
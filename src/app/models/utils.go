@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
-	"math"
 	"net/smtp"
 	"strconv"
 	"strings"
@@ -79,30 +78,6 @@ func RemoveOldPasswordTokens() {
 	db.C("passwordtokens").Remove(bson.M{"createdon": bson.M{"$lt": time.Now().Add(aDayAgo)}})
 }
 
-type WilsonSorter []bson.M
-
-func (ws WilsonSorter) Len() int {
-	return len(ws)
-}
-func (ws WilsonSorter) Less(i, j int) bool { // reverse sorting
-	return ws[i]["wilson"].(float64) > ws[j]["wilson"].(float64)
-}
-func (ws WilsonSorter) Swap(i, j int) {
-	ws[i], ws[j] = ws[j], ws[i]
-}
-
-func Wilson(count int, sum float64) float64 {
-	if count <= 0 {
-		return 0
-	}
-	n := float64(count)
-	z := 1.96 // 95% percentile of normal distribution
-	k := 4.0  // (number of items) - 1
-	avg := sum / n
-	lower := (avg + z*z/(2*n) - z*math.Sqrt((k*avg*(1-avg)+z*z/(4*n))/n)) / (1 + k*z*z/n)
-	return 1 + 4*lower
-}
-
 func Log(msg ...string) {
 	go func() {
 		if _, err := sentry.CaptureMessage(msg...); err != nil {
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"sync"
+	"time"
+)
+
+const (
+	LOW_ENGAGEMENT_VIEWS = 100 // views needed before judging the engagement
+	LOW_ENGAGEMENT_RATIO = 0.01
+	MAX_SEEN_VIEWS       = 500000 // views of a viewer and photo remembered in a day
+)
+
+// views are counted in memory, deduplicated per viewer and day, and
+// written in batches by FlushViews.
+var views = &viewBuffer{
+	pending: make(map[viewKey]viewCount),
+	seen:    make(map[string]bool),
+}
+
+type viewBuffer struct {
+	sync.Mutex
+	day     time.Time
+	pending map[viewKey]viewCount
+	seen    map[string]bool
+}
+
+type viewKey struct {
+	photo bson.ObjectId
+	day   time.Time
+}
+
+// viewCount holds the views not yet added to the photo score and to the
+// daily views, they are written separately.
+type viewCount struct {
+	score, daily int
+}
+
+type DayViews struct {
+	Id    bson.ObjectId `bson:"_id,omitempty"`
+	Photo bson.ObjectId
+	Day   time.Time
+	Count int
+}
+
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// TrackView counts a view of the photo once per viewer and day. When
+// MAX_SEEN_VIEWS views are remembered the new ones are not counted until the
+// next day, to bound the memory.
+func TrackView(viewer string, photo bson.ObjectId) {
+	views.Lock()
+	defer views.Unlock()
+	if day := today(); !day.Equal(views.day) {
+		views.day = day
+		views.seen = make(map[string]bool)
+	}
+	key := viewer + photo.Hex()
+	if views.seen[key] || len(views.seen) >= MAX_SEEN_VIEWS {
+		return
+	}
+	views.seen[key] = true
+	k := viewKey{photo, views.day}
+	c := views.pending[k]
+	c.score++
+	c.daily++
+	views.pending[k] = c
+}
+
+// FlushViews periodically writes the buffered views.
+func FlushViews(interval time.Duration) {
+	for _ = range time.Tick(interval) {
+		if err := flushViews(); err != nil {
+			Log("error saving views: ", err.Error())
+		}
+	}
+}
+
+// flushViews writes the pending views, the ones that failed are put back
+// for the next flush.
+func flushViews() (err error) {
+	views.Lock()
+	pending := views.pending
+	views.pending = make(map[viewKey]viewCount)
+	views.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	db := db_session.Clone().DB(database)
+	defer db.Session.Close()
+	failed := make(map[viewKey]viewCount)
+	for key, c := range pending {
+		if c.score > 0 {
+			// the engagement rank changes with the views
+			if e := updateScore(db, key.photo, bson.M{"$inc": bson.M{"score.views": c.score}}); e == nil || e == mgo.ErrNotFound {
+				c.score = 0
+			} else {
+				err = e
+			}
+		}
+		if c.daily > 0 {
+			if _, e := db.C("views").Upsert(bson.M{"photo": key.photo, "day": key.day}, bson.M{"$inc": bson.M{"count": c.daily}}); e == nil {
+				c.daily = 0
+			} else {
+				err = e
+			}
+		}
+		if c.score > 0 || c.daily > 0 {
+			failed[key] = c
+		}
+	}
+	if len(failed) > 0 {
+		views.Lock()
+		for key, c := range failed {
+			p := views.pending[key]
+			p.score += c.score
+			p.daily += c.daily
+			views.pending[key] = p
+		}
+		views.Unlock()
+	}
+	return
+}
+
+func ensureViewIndexes(db *mgo.Database) {
+	if err := db.C("views").EnsureIndex(mgo.Index{Key: []string{"photo", "day"}, Unique: true}); err != nil {
+		Log("views index: ", err.Error())
+	}
+}
+
+// LowEngagement returns the active photos seen many times but rarely voted.
+func LowEngagement(ctx *Context, limit int) (photos []*Photo, err error) {
+	err = ctx.C("photos").Pipe([]bson.M{
+		{"$match": bson.M{"active": true, "score.views": bson.M{"$gte": LOW_ENGAGEMENT_VIEWS}}},
+		{"$project": bson.M{
+			"title": 1, "user": 1, "score": 1,
+			"conversion": bson.M{"$divide": []interface{}{bson.M{"$ifNull": []interface{}{"$score.count", 0}}, "$score.views"}},
+		}},
+		{"$match": bson.M{"conversion": bson.M{"$lt": LOW_ENGAGEMENT_RATIO}}},
+		{"$sort": bson.M{"conversion": 1}},
+		{"$limit": limit},
+	}).All(&photos)
+	return
+}
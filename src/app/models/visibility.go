@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"labix.org/v2/mgo/bson"
+)
+
+// contest visibility modes
+const (
+	VISIBILITY_PUBLIC   = "public"   // listed for everybody
+	VISIBILITY_UNLISTED = "unlisted" // reachable by link only
+	VISIBILITY_INVITE   = "invite"   // only the invited users take part
+)
+
+var ErrInviteCode = errors.New("Invalid invitation code")
+
+// AdmitFields selects the contest fields needed by Admits.
+var AdmitFields = bson.M{"user": 1, "organizers": 1, "public": 1, "visibility": 1, "invited": 1, "jurors": 1}
+
+// VisibilityMode returns the visibility, public for the older contests.
+func (c *Contest) VisibilityMode() string {
+	if c.Visibility == "" {
+		return VISIBILITY_PUBLIC
+	}
+	return c.Visibility
+}
+
+// InviteOnly tells if only the invited users can take part.
+func (c *Contest) InviteOnly() bool {
+	return c.VisibilityMode() == VISIBILITY_INVITE
+}
+
+// IsInvited tells if the user was invited or joined with the code.
+func (c *Contest) IsInvited(user bson.ObjectId) bool {
+	return hasMember(c.Invited, user)
+}
+
+// Admits tells if the user can see, enter and vote the contest. The drafts
+// are seen only by the organizers, the invite only contests also by the
+// invited users and the jurors.
+func (c *Contest) Admits(u *User) bool {
+	if u != nil && c.Allows(u.Id, PERM_STATUS) {
+		return true
+	}
+	if !c.Public {
+		return false
+	}
+	if !c.InviteOnly() {
+		return true
+	}
+	return u != nil && (c.IsInvited(u.Id) || c.IsJuror(u.Id))
+}
+
+// ListedQuery matches the contests shown in the contest lists to the user:
+// the public ones and the invite only ones the user was invited to.
+func ListedQuery(u *User) bson.M {
+	listed := []bson.M{{"visibility": bson.M{"$nin": []string{VISIBILITY_UNLISTED, VISIBILITY_INVITE}}}}
+	if u != nil {
+		listed = append(listed, bson.M{"visibility": VISIBILITY_INVITE, "invited._id": u.Id})
+	}
+	return bson.M{"public": true, "$or": listed}
+}
+
+// NewInviteCode returns a code for the invitation link.
+func NewInviteCode() string {
+	return GenUUID()
+}
+
+// InviteUser adds the user to the invite only contest and tells them about
+// it.
+func InviteUser(ctx *Context, c *Contest, u *User) error {
+	if err := joinContest(ctx, c.Id, u); err != nil {
+		return err
+	}
+	body := "You were invited to take part in the contest " + c.Name + "."
+	if err := notifyContest(ctx, c, u.Id, "invitation", body); err != nil {
+		Log("error inviting user: ", err.Error())
+	}
+	Publish(UserTopic(u.Id), "contest_invite", map[string]string{"id": c.Id.Hex(), "name": c.Name})
+	return nil
+}
+
+// UninviteUser takes the user out of the invite only contest.
+func UninviteUser(ctx *Context, contest, user bson.ObjectId) error {
+	return ctx.C("contests").UpdateId(contest, bson.M{"$pull": bson.M{"invited": bson.M{"_id": user}}})
+}
+
+// JoinWithCode adds the user to the invite only contest if the code matches.
+func JoinWithCode(ctx *Context, c *Contest, u *User, code string) error {
+	if !c.InviteOnly() || c.InviteCode == "" || code != c.InviteCode {
+		return ErrInviteCode
+	}
+	if c.IsInvited(u.Id) {
+		return nil
+	}
+	return joinContest(ctx, c.Id, u)
+}
+
+func joinContest(ctx *Context, contest bson.ObjectId, u *User) error {
+	i := &Member{Id: u.Id, Name: u.FullName()}
+	return ctx.C("contests").Update(bson.M{"_id": contest, "invited._id": bson.M{"$ne": u.Id}}, bson.M{"$push": bson.M{"invited": i}})
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"testing"
+)
+
+func TestContestAdmits(t *testing.T) {
+	owner, invited, juror, other := &User{Id: bson.NewObjectId()}, &User{Id: bson.NewObjectId()}, &User{Id: bson.NewObjectId()}, &User{Id: bson.NewObjectId()}
+	contest := func(public bool, visibility string) *Contest {
+		return &Contest{User: owner.Id, Public: public, Visibility: visibility, Invited: []*Member{{Id: invited.Id}}, Jurors: []*Member{{Id: juror.Id}}}
+	}
+	tests := []struct {
+		name    string
+		contest *Contest
+		user    *User
+		want    bool
+	}{
+		{"draft owner", contest(false, ""), owner, true},
+		{"draft other", contest(false, ""), other, false},
+		{"public anonymous", contest(true, ""), nil, true},
+		{"unlisted other", contest(true, VISIBILITY_UNLISTED), other, true},
+		{"invite anonymous", contest(true, VISIBILITY_INVITE), nil, false},
+		{"invite other", contest(true, VISIBILITY_INVITE), other, false},
+		{"invite invited", contest(true, VISIBILITY_INVITE), invited, true},
+		{"invite juror", contest(true, VISIBILITY_INVITE), juror, true},
+		{"invite owner", contest(true, VISIBILITY_INVITE), owner, true},
+	}
+	for _, tt := range tests {
+		if got := tt.contest.Admits(tt.user); got != tt.want {
+			t.Errorf("%s: got %v", tt.name, got)
+		}
+	}
+}
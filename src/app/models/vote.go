@@ -23,9 +23,35 @@ type Vote struct {
 	Score       float64
 	UpdatedOn   time.Time
 	User        bson.ObjectId
+	IP          string       `bson:"ip,omitempty"`
+	Distrust    float64      `bson:"distrust,omitempty"` // copied from the voter
+	Voter       Demographics `bson:"voter,omitempty"`
+}
+
+// Demographics of the voter at the time of the vote, the other
+// demographic fields of the vote are copied from the photo.
+type Demographics struct {
+	Country  string
+	Location string
+	Gender   string
+	Age      int
+}
+
+func VoterDemographics(u *User) Demographics {
+	d := Demographics{Country: u.Country, Location: u.Location, Gender: u.Gender}
+	if !u.BirthDate.IsZero() {
+		d.Age = u.Age()
+	}
+	return d
+}
+
+// Weight is the trust in the voter applied when aggregating the vote.
+func (v *Vote) Weight() float64 {
+	return 1 - v.Distrust
 }
 
 type Filter struct {
+	Name     string `bson:"name,omitempty"`
 	Country  string
 	Location string
 	MinAge   int
@@ -81,20 +107,21 @@ func (f *Filter) Age() (result string) {
 	return
 }
 
-func (f *Filter) String() (result string) {
+func (f *Filter) String() string {
+	var parts []string
 	if f.Country != "" {
-		result += "country: " + f.Country
+		parts = append(parts, "country: "+f.Country)
 	}
 	if f.Location != "" {
-		result += "location: " + f.Location
+		parts = append(parts, "location: "+f.Location)
 	}
 	if f.Age() != "" {
-		result += "age: " + f.Age()
+		parts = append(parts, "age: "+f.Age())
 	}
 	if f.Gender != "" {
-		result += "gender: " + f.Gender
+		parts = append(parts, "gender: "+f.Gender)
 	}
-	return
+	return strings.Join(parts, ", ")
 }
 
 func (f *Filter) AddQuery(m bson.M) {
@@ -113,6 +140,7 @@ func (f *Filter) AddQuery(m bson.M) {
 			ageQuery = bson.M{}
 		}
 		ageQuery["$lte"] = f.MaxAge
+		m["age"] = ageQuery
 	}
 	if f.Gender != "" {
 		m["gender"] = f.Gender